@@ -5,92 +5,161 @@ import (
 
 	"github.com/anchore/syft/syft/pkg"
 	"github.com/anchore/syft/syft/sbom"
+	"github.com/anchore/syft/syft/source"
 )
 
+// Info sizes are in bytes, a size the source doesn't record is left at 0.
 type Info struct {
-	Count         int
-	Size          string
-	InstalledSize string
+	Count int
+	// CompressedSize is the size as shipped, e.g. the apk archive
+	CompressedSize int64
+	// UncompressedSize is the size of the uncompressed layer or archive
+	UncompressedSize int64
+	// InstalledSize is the size once unpacked on the filesystem, as declared
+	// by the package metadata
+	InstalledSize int64
+	// OnDiskSize is the size of the files actually found in the image
+	OnDiskSize int64
+	// Images lists the archives the entry was found in
+	Images []string
+	// Variants lists the package identities merged into a by-name entry
+	Variants []string
 }
 
 type Stats struct {
-	BaseOS   map[string]*Info
+	// Source is the bundle, or Zarf package component, the image came from
+	Source string
+	BaseOS map[string]*Info
+	// DistroID and DistroVersionID are the os-release ID and VERSION_ID of the base OS
+	DistroID        string
+	DistroVersionID string
+	// Packages is keyed by package identity, see packageIdentity
 	Packages map[string]*Info
 	Runtimes map[string]map[string]*Info //map["imageFile"]["runtime"]*Info
+	// RuntimeInstalls details the runtimes counted in Runtimes
+	RuntimeInstalls []Runtime
+	Files           FileOwnership
+	// Layers are empty for guest root filesystems, the first BaseLayers of
+	// them come from the base image
+	Layers     []Layer
+	BaseLayers int
+	// PackageOrigins are keyed by package identity like Packages, see
+	// AttributePackageLayers
+	PackageOrigins  map[string]*PackageOrigin
+	RemovedPackages []PackageChange
+	// UntrackedPackageDatabases are the OS package databases of the image
+	// whose snapshots can't be read, e.g. rpm, the upgrades and removals of
+	// their packages aren't known
+	UntrackedPackageDatabases []string
+	packageSources            map[string]packageSource
 }
 
 func NewStats() *Stats {
 	return &Stats{
-		BaseOS:   make(map[string]*Info),
-		Packages: make(map[string]*Info),
-		Runtimes: make(map[string]map[string]*Info),
+		BaseOS:         make(map[string]*Info),
+		Packages:       make(map[string]*Info),
+		Runtimes:       make(map[string]map[string]*Info),
+		packageSources: make(map[string]packageSource),
 	}
 }
 
-func AggregateData(individualArchivesPathDir, archiveName string, archiveSbom *sbom.SBOM) (*Stats, error) {
+// AggregateData sums the SBOM of an archive, or of a guest root filesystem
+// with the hardlinks it was extracted with.
+func AggregateData(individualArchivesPathDir, archiveName string, archiveSbom *sbom.SBOM, hardlinks map[string]string) (*Stats, error) {
 	stats := NewStats()
 	stats.Runtimes[archiveName] = make(map[string]*Info)
 
 	osNameWithVersion := archiveSbom.Artifacts.LinuxDistribution.PrettyName
 	if stats.BaseOS[osNameWithVersion] == nil {
-		stats.BaseOS[osNameWithVersion] = &Info{
-			Count: 1,
-			Size:  ConvertSizeBytesToHumanReadableString(GetBaseImageSize(archiveName)),
-		}
+		stats.BaseOS[osNameWithVersion] = newBaseInfo(archiveName, archiveSbom, hardlinks)
 	} else {
 		stats.BaseOS[osNameWithVersion].Count++
 	}
+	stats.DistroID = archiveSbom.Artifacts.LinuxDistribution.ID
+	stats.DistroVersionID = archiveSbom.Artifacts.LinuxDistribution.VersionID
 
-	for _, currentPackage := range archiveSbom.Artifacts.Packages.Sorted() {
-		if stats.Packages[currentPackage.Name] == nil {
-			size := 0
-			installedSize := 0
-
-			switch metadata := currentPackage.Metadata.(type) {
-			case pkg.ApkDBEntry:
-				size = metadata.Size
-				installedSize = metadata.InstalledSize
-			case pkg.DpkgDBEntry:
-				// doesn't have metadata.Size
-				installedSize = metadata.InstalledSize
-			case pkg.AlpmDBEntry:
-				size = metadata.Size
-				// doesn't have metadata.InstalledSize
-			case pkg.RpmDBEntry:
-				size = metadata.Size
-				// doesn't have metadata.InstalledSize
-			default:
-				fmt.Printf("error decoding metadata for package %s of archive %s \n", currentPackage.Name, archiveName)
-				continue
-			}
+	if _, ok := archiveSbom.Source.Metadata.(source.DirectoryMetadata); !ok {
+		layers, err := ReadImageLayers(archiveName)
+		if err != nil {
+			return nil, fmt.Errorf("error reading layers: %w", err)
+		}
+		stats.Layers = layers
+	}
 
-			stats.Packages[currentPackage.Name] = &Info{
-				Count:         1,
-				Size:          ConvertSizeBytesToHumanReadableString(int64(size)),
-				InstalledSize: ConvertSizeBytesToHumanReadableString(int64(installedSize)),
-			}
+	files := newFileIndex(archiveSbom, hardlinks)
+	var osFiles, languageFiles []string
+	// a package found several times, e.g. a jar vendored in two directories,
+	// owns the files of every copy
+	ownedFiles := map[string][]string{}
+	for _, currentPackage := range archiveSbom.Artifacts.Packages.Sorted() {
+		identity := packageIdentity(currentPackage)
+		info := stats.Packages[identity]
+		if info == nil {
+			info = &Info{Images: []string{archiveName}}
+			stats.Packages[identity] = info
+		}
+		info.Count++
 
+		// OS packages list the files they own, the language ones are found
+		// from where they were cataloged
+		var packageFiles []string
+		isOSPackage := true
+		databaseName, database := currentPackage.Name, ""
+		switch metadata := currentPackage.Metadata.(type) {
+		case pkg.ApkDBEntry:
+			database = "apk"
+			info.CompressedSize = int64(metadata.Size)
+			info.InstalledSize = int64(metadata.InstalledSize)
+			packageFiles = metadata.OwnedFiles()
+		case pkg.DpkgDBEntry:
+			database = "dpkg"
+			databaseName = dpkgPackageKey(metadata.Package, metadata.Architecture)
+			// Installed-Size is in KiB and there is no archive size
+			info.InstalledSize = int64(metadata.InstalledSize) * 1024
+			packageFiles = metadata.OwnedFiles()
+		case pkg.AlpmDBEntry:
+			database = "alpm"
+			// the local pacman database only records the installed size
+			info.InstalledSize = int64(metadata.Size)
+			packageFiles = metadata.OwnedFiles()
+		case pkg.RpmDBEntry:
+			database = "rpm"
+			// RPMTAG_SIZE is the sum of the installed file sizes
+			info.InstalledSize = int64(metadata.Size)
+			packageFiles = metadata.OwnedFiles()
+		default:
+			isOSPackage = false
+			packageFiles = languagePackageFiles(currentPackage, files)
+		}
+		if isOSPackage {
+			osFiles = append(osFiles, packageFiles...)
 		} else {
-			stats.Packages[currentPackage.Name].Count++
+			languageFiles = append(languageFiles, packageFiles...)
 		}
+		ownedFiles[identity] = append(ownedFiles[identity], packageFiles...)
+		info.OnDiskSize = files.onDiskSize(ownedFiles[identity])
 
-		// TODO: fix this
-		// DetectRuntime(packageInfo[packageName], stats.Runtimes, archiveName)
+		source := stats.packageSources[identity]
+		source.name, source.isOS, source.database = databaseName, isOSPackage, database
+		for _, packageFile := range packageFiles {
+			source.files = append(source.files, files.resolve(packageFile))
+		}
+		for _, location := range currentPackage.Locations.ToSlice() {
+			source.layerIDs = append(source.layerIDs, location.FileSystemID)
+		}
+		stats.packageSources[identity] = source
 	}
 
-	// TODO: fix this
+	stats.RuntimeInstalls = DetectRuntimes(archiveSbom, files)
+	for _, runtime := range stats.RuntimeInstalls {
+		if stats.Runtimes[archiveName][runtime.Key()] == nil {
+			stats.Runtimes[archiveName][runtime.Key()] = &Info{Images: []string{archiveName}}
+		}
+		stats.Runtimes[archiveName][runtime.Key()].Count++
+		stats.Runtimes[archiveName][runtime.Key()].OnDiskSize += runtime.Size
+	}
 
-	// for _, fileName := range syftJSONFilesSlc {
-	// 	for k, v := range stats.Runtimes[fileName] {
-	// 		sizeInt64, err := strconv.ParseInt(v.Size, 10, 64)
-	// 		if err != nil {
-	// 			fmt.Printf("Failed to convert string to int64 %v\n", err)
-	// 			os.Exit(1)
-	// 		}
-	// 		v.Size = ConvertSizeBytesToHumanReadableString(sizeInt64)
-	// 		stats.Runtimes[fileName][k] = v
-	// 	}
-	// }
+	stats.Files = files.ownership(osFiles, languageFiles)
 
 	return stats, nil
 }
@@ -6,10 +6,15 @@ import (
 	"path/filepath"
 
 	"github.com/anchore/syft/syft"
+	"github.com/anchore/syft/syft/cataloging/filecataloging"
+	"github.com/anchore/syft/syft/file"
+	"github.com/anchore/syft/syft/file/cataloger/filecontent"
 	"github.com/anchore/syft/syft/sbom"
 )
 
-func Analyze(individualArchivesDir string) (map[string]*Stats, error) {
+// Analyze catalogs the individual archives and the guest root filesystems,
+// given as the hardlinks extracted in every root filesystem directory.
+func Analyze(individualArchivesDir string, guestRootFsHardlinks map[string]map[string]string) (map[string]*Stats, error) {
 	fmt.Println("Started analyzing individual archives...")
 
 	ctx := context.Background()
@@ -19,15 +24,33 @@ func Analyze(individualArchivesDir string) (map[string]*Stats, error) {
 		return nil, fmt.Errorf("error analyzing individual archives: %w", err)
 	}
 
+	// the guest OS of the appliance VM is analyzed as one more image
+	for guestRootFsDir := range guestRootFsHardlinks {
+		fmt.Println("Generating SBOM for guest root filesystem:", guestRootFsDir)
+
+		guestSbom, err := generateSbom(ctx, guestRootFsDir)
+		if err != nil {
+			return nil, fmt.Errorf("error generating SBOM for guest root filesystem %s: %w", guestRootFsDir, err)
+		}
+		archivesWithSboms[guestRootFsDir] = guestSbom
+	}
+
 	archivesStats := map[string]*Stats{}
 	for archiveName, archiveSbom := range archivesWithSboms {
-		archiveStats, err := AggregateData(individualArchivesDir, archiveName, archiveSbom)
+		archiveStats, err := AggregateData(individualArchivesDir, archiveName, archiveSbom, guestRootFsHardlinks[archiveName])
 		if err != nil {
 			return nil, fmt.Errorf("error aggregating data for individual archive %s: %w", archiveName, err)
 		}
 
 		archivesStats[archiveName] = archiveStats
 	}
+	DetectBaseImages(archivesStats)
+	if err := FingerprintLayers(archivesStats); err != nil {
+		return nil, fmt.Errorf("error fingerprinting layers: %w", err)
+	}
+	for _, archiveStats := range archivesStats {
+		AttributePackageLayers(archiveStats)
+	}
 
 	fmt.Println("Finished analyzing individual successfully.")
 	return archivesStats, nil
@@ -55,15 +78,23 @@ func analyzeArchives(ctx context.Context, individualArchivesDir string) (map[str
 	return archiveWithSbom, nil
 }
 
-func generateSbom(ctx context.Context, individualArchivePath string) (*sbom.SBOM, error) {
-	src, err := syft.GetSource(ctx, individualArchivePath, nil)
+func generateSbom(ctx context.Context, sourcePath string) (*sbom.SBOM, error) {
+	src, err := syft.GetSource(ctx, sourcePath, nil)
 	if err != nil {
-		return nil, fmt.Errorf("error getting docker archive: %w", err)
+		return nil, fmt.Errorf("error getting source: %w", err)
 	}
 
-	sbom, err := syft.CreateSBOM(ctx, src, nil)
+	// the size of every file is needed to size packages without a size in
+	// their metadata, file digests are not
+	contentConfig := filecontent.DefaultConfig()
+	contentConfig.Globs = runtimeContentGlobs
+	cfg := syft.DefaultCreateSBOMConfig().WithFilesConfig(
+		filecataloging.DefaultConfig().WithSelection(file.AllFilesSelection).WithHashers().WithContentConfig(contentConfig),
+	)
+
+	sbom, err := syft.CreateSBOM(ctx, src, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("error creating SBOM for docker archive: %w", err)
+		return nil, fmt.Errorf("error creating SBOM for source: %w", err)
 	}
 
 	return sbom, nil
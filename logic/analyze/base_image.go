@@ -0,0 +1,190 @@
+package analyze
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// buildGap separates the history of an image from the one of its base
+// image, the steps of a single build are created minutes apart at most.
+const buildGap = time.Hour
+
+// BaseImage is the layers images share at the bottom of their stacks.
+type BaseImage struct {
+	// Name is the image that is exactly this base when there is one
+	Name   string
+	Layers []Layer
+	Size   int64
+	// Bases are the base images built on top of this one
+	Bases  []*BaseImage
+	Images []DerivedImage
+}
+
+// DerivedImage is an image built on a base image, sized by its own layers.
+type DerivedImage struct {
+	Name      string
+	OwnLayers int
+	OwnSize   int64
+}
+
+// DetectBaseImages finds the layers every image gets from its base image:
+// the longest layer prefix it shares with another image. An image sharing no
+// layer falls back on its history, the layers created before the last gap
+// between two steps come from a previous build. Failing that an image other
+// images are built on is a base of its own, and any other image gets its
+// first layer from its base.
+// The size of the base OS of the image is the sum of these layers.
+func DetectBaseImages(archivesStats map[string]*Stats) {
+	for archiveName, stats := range archivesStats {
+		if len(stats.Layers) == 0 {
+			continue
+		}
+
+		baseLayers := 0
+		isBaseOfOthers := false
+		for otherName, otherStats := range archivesStats {
+			if otherName == archiveName {
+				continue
+			}
+			// an image that is entirely shared is the base of the other one
+			common := commonLayerPrefix(stats.Layers, otherStats.Layers)
+			if common < len(stats.Layers) {
+				baseLayers = max(baseLayers, common)
+			} else if len(otherStats.Layers) > common {
+				isBaseOfOthers = true
+			}
+		}
+		if baseLayers == 0 {
+			baseLayers = historyBaseLayers(stats.Layers)
+		}
+		if baseLayers == 0 && isBaseOfOthers {
+			baseLayers = len(stats.Layers)
+		}
+		if baseLayers == 0 {
+			baseLayers = 1
+		}
+
+		stats.BaseLayers = baseLayers
+		for _, info := range stats.BaseOS {
+			info.UncompressedSize = layersSize(stats.Layers[:baseLayers])
+		}
+	}
+}
+
+// BuildBaseImageTree groups the images by base image, base images built on
+// other base images are nested under them. The largest bases come first.
+func BuildBaseImageTree(archivesStats map[string]*Stats) []*BaseImage {
+	var archiveNames []string
+	for archiveName := range archivesStats {
+		archiveNames = append(archiveNames, archiveName)
+	}
+	sort.Strings(archiveNames)
+
+	basesByChain := map[string]*BaseImage{}
+	var bases []*BaseImage
+	for _, archiveName := range archiveNames {
+		stats := archivesStats[archiveName]
+		if stats.BaseLayers == 0 {
+			continue
+		}
+
+		baseLayers := stats.Layers[:stats.BaseLayers]
+		chain := layerChain(baseLayers)
+		base := basesByChain[chain]
+		if base == nil {
+			base = &BaseImage{Layers: baseLayers, Size: layersSize(baseLayers)}
+			for baseOS := range stats.BaseOS {
+				base.Name = fmt.Sprintf("%s base %s", baseOS, shortLayerDigest(baseLayers[len(baseLayers)-1].DiffID))
+			}
+			basesByChain[chain] = base
+			bases = append(bases, base)
+		}
+		ownLayers := stats.Layers[stats.BaseLayers:]
+		base.Images = append(base.Images, DerivedImage{Name: archiveName, OwnLayers: len(ownLayers), OwnSize: layersSize(ownLayers)})
+	}
+
+	// a base that is a whole image takes its name
+	for _, archiveName := range archiveNames {
+		if base := basesByChain[layerChain(archivesStats[archiveName].Layers)]; base != nil {
+			base.Name = filepath.Base(archiveName)
+		}
+	}
+
+	// the parent of a base is the longest other base it starts with
+	sort.Slice(bases, func(i, j int) bool {
+		return len(bases[i].Layers) < len(bases[j].Layers)
+	})
+	var roots []*BaseImage
+	for i, base := range bases {
+		var parent *BaseImage
+		for _, candidate := range bases[:i] {
+			if len(candidate.Layers) < len(base.Layers) && commonLayerPrefix(candidate.Layers, base.Layers) == len(candidate.Layers) {
+				parent = candidate
+			}
+		}
+		if parent == nil {
+			roots = append(roots, base)
+		} else {
+			parent.Bases = append(parent.Bases, base)
+		}
+	}
+
+	sortBaseImages(roots)
+	return roots
+}
+
+func sortBaseImages(bases []*BaseImage) {
+	sort.Slice(bases, func(i, j int) bool {
+		if bases[i].Size == bases[j].Size {
+			return bases[i].Name < bases[j].Name
+		}
+		return bases[i].Size > bases[j].Size
+	})
+	for _, base := range bases {
+		sortBaseImages(base.Bases)
+	}
+}
+
+// commonLayerPrefix counts the layers two stacks start with, a layer without
+// a diffID matches no other layer.
+func commonLayerPrefix(layers, otherLayers []Layer) int {
+	common := 0
+	for common < len(layers) && common < len(otherLayers) && layers[common].DiffID != "" && layers[common].DiffID == otherLayers[common].DiffID {
+		common++
+	}
+	return common
+}
+
+// historyBaseLayers counts the layers created before the last gap of more
+// than buildGap in the history of the image, 0 without such a gap.
+func historyBaseLayers(layers []Layer) int {
+	baseLayers := 0
+	for i := 1; i < len(layers); i++ {
+		if layers[i-1].Created.IsZero() || layers[i].Created.IsZero() {
+			continue
+		}
+		if layers[i].Created.Sub(layers[i-1].Created) > buildGap {
+			baseLayers = i
+		}
+	}
+	return baseLayers
+}
+
+func layerChain(layers []Layer) string {
+	var diffIDs []string
+	for _, layer := range layers {
+		diffIDs = append(diffIDs, layer.DiffID)
+	}
+	return strings.Join(diffIDs, ",")
+}
+
+func shortLayerDigest(digest string) string {
+	hex := strings.TrimPrefix(digest, "sha256:")
+	if len(hex) > 12 {
+		hex = hex[:12]
+	}
+	return hex
+}
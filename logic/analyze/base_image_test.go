@@ -0,0 +1,66 @@
+package analyze
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectBaseImages(t *testing.T) {
+	built := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	layer := func(diffID string, size int64) Layer {
+		return Layer{DiffID: diffID, Size: size}
+	}
+	createdLayer := func(diffID string, created time.Time) Layer {
+		return Layer{DiffID: diffID, Size: 1, Created: created}
+	}
+
+	archivesStats := map[string]*Stats{
+		// an image other images are built on is a base of its own
+		"alpine.tar": {Layers: []Layer{layer("sha256:alpine", 7)}},
+		"app.tar":    {Layers: []Layer{layer("sha256:alpine", 7), layer("sha256:app", 20)}},
+		"worker.tar": {Layers: []Layer{layer("sha256:alpine", 7), layer("sha256:runtime", 30), layer("sha256:worker", 5)}},
+		"api.tar":    {Layers: []Layer{layer("sha256:alpine", 7), layer("sha256:runtime", 30), layer("sha256:api", 8)}},
+		// the base image was built days before the image
+		"history.tar": {Layers: []Layer{
+			createdLayer("sha256:h1", built),
+			createdLayer("sha256:h2", built.Add(time.Minute)),
+			createdLayer("sha256:h3", built.Add(48*time.Hour)),
+			createdLayer("sha256:h4", built.Add(48*time.Hour+time.Minute)),
+		}},
+		"lone.tar": {Layers: []Layer{layer("sha256:lone1", 1), layer("sha256:lone2", 1)}},
+		// layers without a diffID are not shared
+		"nodiff1.tar": {Layers: []Layer{layer("", 1), layer("", 1)}},
+		"nodiff2.tar": {Layers: []Layer{layer("", 1), layer("", 1), layer("", 1)}},
+		"guest":       {},
+	}
+	for _, stats := range archivesStats {
+		stats.BaseOS = map[string]*Info{"alpine 3.19": {}}
+	}
+
+	DetectBaseImages(archivesStats)
+
+	tests := []struct {
+		archive        string
+		wantBaseLayers int
+		wantBaseSize   int64
+	}{
+		{archive: "alpine.tar", wantBaseLayers: 1, wantBaseSize: 7},
+		{archive: "app.tar", wantBaseLayers: 1, wantBaseSize: 7},
+		{archive: "worker.tar", wantBaseLayers: 2, wantBaseSize: 37},
+		{archive: "api.tar", wantBaseLayers: 2, wantBaseSize: 37},
+		{archive: "history.tar", wantBaseLayers: 2, wantBaseSize: 2},
+		{archive: "lone.tar", wantBaseLayers: 1, wantBaseSize: 1},
+		{archive: "nodiff1.tar", wantBaseLayers: 1, wantBaseSize: 1},
+		{archive: "nodiff2.tar", wantBaseLayers: 1, wantBaseSize: 1},
+		{archive: "guest", wantBaseLayers: 0, wantBaseSize: 0},
+	}
+	for _, test := range tests {
+		stats := archivesStats[test.archive]
+		if stats.BaseLayers != test.wantBaseLayers {
+			t.Errorf("DetectBaseImages() base layers of %s = %d, want %d", test.archive, stats.BaseLayers, test.wantBaseLayers)
+		}
+		if got := stats.BaseOS["alpine 3.19"].UncompressedSize; got != test.wantBaseSize {
+			t.Errorf("DetectBaseImages() base OS size of %s = %d, want %d", test.archive, got, test.wantBaseSize)
+		}
+	}
+}
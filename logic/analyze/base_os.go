@@ -1,14 +1,13 @@
 package analyze
 
 import (
-	"context"
 	"fmt"
-	"log"
+	"io/fs"
+	"path/filepath"
 	"regexp"
 
-	"github.com/containers/image/v5/image"
-	"github.com/containers/image/v5/transports/alltransports"
-	"github.com/containers/image/v5/types"
+	"github.com/anchore/syft/syft/sbom"
+	"github.com/anchore/syft/syft/source"
 )
 
 func DetectOSNameWithVersion(distro string) (osNameWithVersion string) {
@@ -22,33 +21,42 @@ func DetectOSNameWithVersion(distro string) (osNameWithVersion string) {
 	return osNameWithVersion
 }
 
-func GetBaseImageSize(individualArchivePath string) int64 {
-	ctx := context.Background()
+func newBaseInfo(archiveName string, archiveSbom *sbom.SBOM, hardlinks map[string]string) *Info {
+	info := &Info{Count: 1, Images: []string{archiveName}}
 
-	ref, err := alltransports.ParseImageName(fmt.Sprintf("docker-archive:%s", individualArchivePath))
-	if err != nil {
-		log.Fatalf("Error parsing image name: %v", err)
-	}
-
-	sysCtx := &types.SystemContext{}
-	imgSrc, err := ref.NewImageSource(ctx, sysCtx)
-	if err != nil {
-		log.Fatalf("Error getting image source: %v", err)
-	}
-	defer imgSrc.Close()
-
-	img, err := image.FromUnparsedImage(ctx, sysCtx, image.UnparsedInstance(imgSrc, nil))
-	if err != nil {
-		log.Fatalf("Error parsing manifest for image: %v", err)
+	// a guest root filesystem has no base image, the whole OS is its base
+	if _, ok := archiveSbom.Source.Metadata.(source.DirectoryMetadata); ok {
+		info.InstalledSize = GetDirectorySize(archiveName, hardlinks)
 	}
+	// the size of a base image is only known once its layers are compared to
+	// the ones of the other images, see DetectBaseImages
+	return info
+}
 
-	imgInspect, err := img.Inspect(ctx)
+// GetDirectorySize sums the regular files below dir, except the hardlinks
+// to a file already counted, keyed by their absolute path in dir.
+func GetDirectorySize(dir string, hardlinks map[string]string) int64 {
+	var size int64
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		relativePath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		if _, ok := hardlinks["/"+filepath.ToSlash(relativePath)]; ok {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
 	if err != nil {
-		log.Fatalf("Error during inspect: %v", err)
+		fmt.Printf("error computing size of directory %s: %v\n", dir, err)
 	}
-
-	// the first layer contain information regarding the base os of the container
-	// fist layer is the FROM directive
-
-	return imgInspect.LayersData[0].Size
+	return size
 }
@@ -0,0 +1,59 @@
+package analyze
+
+import "sort"
+
+// PackageDrift is a package shipped in more than one build across images.
+type PackageDrift struct {
+	Name string
+	// Variants are sorted by number of images, the most common build first
+	Variants []DriftVariant
+	// EstimatedSavings is the size of the copies of the other builds, which
+	// could share the layer of the most common one once images converge on it
+	EstimatedSavings int64
+}
+
+type DriftVariant struct {
+	Identity string
+	Version  string
+	Distro   string
+	Images   []string
+	Size     int64
+}
+
+func DetectVersionDrift(rollup *Rollup) []PackageDrift {
+	var drifts []PackageDrift
+	for name, byName := range rollup.PackagesByName {
+		if len(byName.Variants) < 2 || byName.Count < 2 {
+			continue
+		}
+
+		drift := PackageDrift{Name: name}
+		for _, identity := range byName.Variants {
+			info := rollup.Packages[identity]
+			version, distro := PackageVersion(identity)
+			drift.Variants = append(drift.Variants, DriftVariant{
+				Identity: identity,
+				Version:  version,
+				Distro:   distro,
+				Images:   info.Images,
+				Size:     info.CopySize(),
+			})
+		}
+		sort.SliceStable(drift.Variants, func(i, j int) bool {
+			return len(drift.Variants[i].Images) > len(drift.Variants[j].Images)
+		})
+
+		for _, variant := range drift.Variants[1:] {
+			drift.EstimatedSavings += int64(len(variant.Images)) * variant.Size
+		}
+		drifts = append(drifts, drift)
+	}
+
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].EstimatedSavings != drifts[j].EstimatedSavings {
+			return drifts[i].EstimatedSavings > drifts[j].EstimatedSavings
+		}
+		return drifts[i].Name < drifts[j].Name
+	})
+	return drifts
+}
@@ -0,0 +1,61 @@
+package analyze
+
+import (
+	"encoding/hex"
+	"sort"
+)
+
+// DuplicatedFile is a file content stored more than once in the bundle, in
+// different layers or at different paths of a layer.
+type DuplicatedFile struct {
+	Digest      string
+	Size        int64
+	Occurrences []FileOccurrence
+	// WastedSize is the size of the copies after the first one
+	WastedSize int64
+}
+
+// FileOccurrence is a path of a layer, the images referencing the layer all
+// see the same copy of the file.
+type FileOccurrence struct {
+	Path   string
+	DiffID string
+	Images []string
+}
+
+// DetectDuplicatedFiles groups the regular files of the distinct layers by
+// content, the largest waste first. It is the file-level counterpart of the
+// package duplicates, whatever package, if any, the files belong to.
+func DetectDuplicatedFiles(sharing LayerSharing) []DuplicatedFile {
+	filesByDigest := map[[32]byte]*DuplicatedFile{}
+	for _, layer := range distinctLayers(sharing) {
+		for _, file := range layer.Fingerprint.Files {
+			if file.Size == 0 {
+				continue
+			}
+			duplicatedFile := filesByDigest[file.Digest]
+			if duplicatedFile == nil {
+				duplicatedFile = &DuplicatedFile{Digest: "sha256:" + hex.EncodeToString(file.Digest[:]), Size: file.Size}
+				filesByDigest[file.Digest] = duplicatedFile
+			}
+			duplicatedFile.Occurrences = append(duplicatedFile.Occurrences, FileOccurrence{Path: file.Path, DiffID: layer.DiffID, Images: layer.Images})
+		}
+	}
+
+	var duplicatedFiles []DuplicatedFile
+	for _, duplicatedFile := range filesByDigest {
+		if len(duplicatedFile.Occurrences) < 2 {
+			continue
+		}
+		duplicatedFile.WastedSize = int64(len(duplicatedFile.Occurrences)-1) * duplicatedFile.Size
+		duplicatedFiles = append(duplicatedFiles, *duplicatedFile)
+	}
+
+	sort.Slice(duplicatedFiles, func(i, j int) bool {
+		if duplicatedFiles[i].WastedSize != duplicatedFiles[j].WastedSize {
+			return duplicatedFiles[i].WastedSize > duplicatedFiles[j].WastedSize
+		}
+		return duplicatedFiles[i].Digest < duplicatedFiles[j].Digest
+	})
+	return duplicatedFiles
+}
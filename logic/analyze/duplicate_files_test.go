@@ -0,0 +1,35 @@
+package analyze
+
+import (
+	"crypto/sha256"
+	"slices"
+	"testing"
+)
+
+func TestDetectDuplicatedFilesMergesRecompressedBlobs(t *testing.T) {
+	libDigest := sha256.Sum256([]byte("lib"))
+	baseFingerprint := &LayerFingerprint{Files: []LayerFile{{Path: "usr/lib/lib.so", Digest: libDigest, Size: 100}}}
+	appFingerprint := &LayerFingerprint{Files: []LayerFile{{Path: "app/lib.so", Digest: libDigest, Size: 100}}}
+
+	// the base layer is stored under two blobs, gzipped with different levels
+	sharing := LayerSharing{Layers: []*SharedLayer{
+		{Digest: "sha256:gz1", DiffID: "sha256:base", Images: []string{"a.tar", "b.tar"}, Fingerprint: baseFingerprint},
+		{Digest: "sha256:gz9", DiffID: "sha256:base", Images: []string{"c.tar"}, Fingerprint: baseFingerprint},
+		{Digest: "sha256:app", DiffID: "sha256:app", Images: []string{"c.tar"}, Fingerprint: appFingerprint},
+	}}
+
+	duplicatedFiles := DetectDuplicatedFiles(sharing)
+	if len(duplicatedFiles) != 1 {
+		t.Fatalf("DetectDuplicatedFiles() = %d files, want 1", len(duplicatedFiles))
+	}
+	occurrences := duplicatedFiles[0].Occurrences
+	if len(occurrences) != 2 || duplicatedFiles[0].WastedSize != 100 {
+		t.Fatalf("occurrences = %+v, wasted %d, want 2 occurrences wasting 100 bytes", occurrences, duplicatedFiles[0].WastedSize)
+	}
+	if want := []string{"a.tar", "b.tar", "c.tar"}; !slices.Equal(occurrences[0].Images, want) {
+		t.Errorf("images of the base occurrence = %v, want %v", occurrences[0].Images, want)
+	}
+	if want := []string{"a.tar", "b.tar"}; !slices.Equal(sharing.Layers[0].Images, want) {
+		t.Errorf("images of the first blob = %v, want them untouched as %v", sharing.Layers[0].Images, want)
+	}
+}
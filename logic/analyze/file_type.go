@@ -0,0 +1,98 @@
+package analyze
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// fileHeadSize is how much of the beginning of a file its type is detected
+// from.
+const fileHeadSize = 512
+
+// The ELF header values telling executables and shared objects apart.
+const (
+	elfDataBigEndian    = 2
+	elfTypeExecutable   = 2
+	elfTypeSharedObject = 3
+)
+
+// fileTypeCollector detects the type of the files of a layer from their
+// head, it runs after fileListCollector to set it on the listed files.
+type fileTypeCollector struct {
+	types map[string]string
+}
+
+func (collector *fileTypeCollector) contentWriter(*tar.Header, string) io.Writer {
+	return nil
+}
+
+func (collector *fileTypeCollector) add(entry layerEntry) {
+	if entry.Header.Typeflag == tar.TypeReg {
+		collector.types[entry.Path] = detectFileType(entry.Path, entry.Head)
+	}
+}
+
+func (collector *fileTypeCollector) finish(fingerprint *LayerFingerprint) {
+	for i, file := range fingerprint.Files {
+		fingerprint.Files[i].Type = collector.types[file.Path]
+	}
+}
+
+// detectFileType tells the type of a file from its first bytes, and from its
+// name for archives sharing a format, e.g. jars are zip files.
+func detectFileType(name string, head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\x7fELF")):
+		if len(head) < 18 {
+			return "ELF"
+		}
+		// e_type is at offset 16 in the byte order of EI_DATA, big-endian
+		// on e.g. s390x and ppc64
+		var byteOrder binary.ByteOrder = binary.LittleEndian
+		if head[5] == elfDataBigEndian {
+			byteOrder = binary.BigEndian
+		}
+		switch byteOrder.Uint16(head[16:18]) {
+		case elfTypeExecutable:
+			return "ELF executable"
+		case elfTypeSharedObject:
+			// position independent executables are shared objects too
+			if strings.Contains(name, ".so") {
+				return "ELF shared object"
+			}
+			return "ELF executable"
+		}
+		return "ELF"
+	case bytes.HasPrefix(head, []byte("!<arch>\n")):
+		return "static library"
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		switch extension := strings.ToLower(path.Ext(name)); extension {
+		case ".jar", ".war", ".ear", ".whl", ".apk", ".nupkg":
+			return strings.TrimPrefix(extension, ".") + " archive"
+		}
+		return "zip archive"
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return "gzip archive"
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return "zstd archive"
+	case bytes.HasPrefix(head, []byte("\xfd7zXZ\x00")):
+		return "xz archive"
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return "bzip2 archive"
+	case len(head) > 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return "tar archive"
+	case bytes.HasPrefix(head, []byte("SQLite format 3\x00")):
+		return "SQLite database"
+	case bytes.HasPrefix(head, []byte("#!")):
+		interpreter, _, _ := strings.Cut(string(head[2:]), "\n")
+		return "script (" + strings.TrimSpace(interpreter) + ")"
+	}
+
+	contentType, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	return contentType
+}
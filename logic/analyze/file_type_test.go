@@ -0,0 +1,67 @@
+package analyze
+
+import (
+	"bytes"
+	"testing"
+)
+
+// elfHead is the start of a little-endian ELF file of the given e_type.
+func elfHead(eType byte) []byte {
+	head := make([]byte, 64)
+	copy(head, "\x7fELF\x02\x01\x01")
+	head[16] = eType
+	return head
+}
+
+// bigEndianElfHead is the start of a big-endian ELF file, e.g. of s390x.
+func bigEndianElfHead(eType byte) []byte {
+	head := make([]byte, 64)
+	copy(head, "\x7fELF\x02\x02\x01")
+	head[17] = eType
+	return head
+}
+
+func tarHead() []byte {
+	head := make([]byte, fileHeadSize)
+	copy(head, "file.txt")
+	copy(head[257:], "ustar\x0000")
+	return head
+}
+
+func TestDetectFileType(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{name: "usr/bin/app", head: elfHead(2), want: "ELF executable"},
+		{name: "usr/lib/libc.so.6", head: elfHead(3), want: "ELF shared object"},
+		// position independent executables are shared objects too
+		{name: "usr/bin/bash", head: elfHead(3), want: "ELF executable"},
+		{name: "usr/lib/debug/app.o", head: elfHead(1), want: "ELF"},
+		{name: "usr/bin/app", head: bigEndianElfHead(2), want: "ELF executable"},
+		{name: "usr/lib64/libc.so.6", head: bigEndianElfHead(3), want: "ELF shared object"},
+		{name: "usr/lib/debug/app.o", head: bigEndianElfHead(1), want: "ELF"},
+		{name: "usr/bin/truncated", head: []byte("\x7fELF\x02\x01\x01"), want: "ELF"},
+		{name: "usr/lib/libz.a", head: []byte("!<arch>\nlibz.o/"), want: "static library"},
+		{name: "opt/app/app.jar", head: []byte("PK\x03\x04\x14\x00"), want: "jar archive"},
+		{name: "opt/app/APP.WAR", head: []byte("PK\x03\x04\x14\x00"), want: "war archive"},
+		{name: "opt/wheels/pkg-1.0-py3-none-any.whl", head: []byte("PK\x03\x04\x14\x00"), want: "whl archive"},
+		{name: "opt/app/data.zip", head: []byte("PK\x03\x04\x14\x00"), want: "zip archive"},
+		{name: "var/cache/app.tar.gz", head: []byte{0x1f, 0x8b, 0x08, 0x00}, want: "gzip archive"},
+		{name: "var/cache/app.tar.zst", head: []byte{0x28, 0xb5, 0x2f, 0xfd, 0x04}, want: "zstd archive"},
+		{name: "var/cache/app.tar.xz", head: []byte("\xfd7zXZ\x00\x00\x04"), want: "xz archive"},
+		{name: "var/cache/app.tar.bz2", head: []byte("BZh91AY&SY"), want: "bzip2 archive"},
+		{name: "var/cache/app.tar", head: tarHead(), want: "tar archive"},
+		{name: "var/lib/rpm/rpmdb.sqlite", head: []byte("SQLite format 3\x00\x10\x00"), want: "SQLite database"},
+		{name: "usr/bin/entrypoint", head: []byte("#!/bin/sh\nexec app\n"), want: "script (/bin/sh)"},
+		{name: "usr/bin/tool", head: []byte("#! /usr/bin/env python3 \nimport sys\n"), want: "script (/usr/bin/env python3)"},
+		{name: "etc/app.conf", head: []byte("key = value\n"), want: "text/plain"},
+		{name: "var/lib/app/blob", head: bytes.Repeat([]byte{0x00, 0x01, 0xfe}, 20), want: "application/octet-stream"},
+	}
+	for _, test := range tests {
+		if got := detectFileType(test.name, test.head); got != test.want {
+			t.Errorf("detectFileType(%q, %q) = %q, want %q", test.name, test.head[:min(len(test.head), 8)], got, test.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package analyze
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/syft/syft/sbom"
+)
+
+const (
+	// maxLinkHops bounds symlink resolution, so link cycles end
+	maxLinkHops = 32
+	// unownedDirDepth is how deep unowned bytes are broken down by directory
+	unownedDirDepth = 3
+)
+
+type FileOwnership struct {
+	OSPackageBytes       int64
+	LanguagePackageBytes int64
+	UnownedBytes         int64
+	// UnownedByDir sums the unowned bytes below every directory up to
+	// unownedDirDepth levels deep, e.g. /opt, /opt/app and /opt/app/lib
+	UnownedByDir map[string]int64
+}
+
+// fileIndex gives the size of the regular files cataloged in an SBOM, and of
+// the directory trees containing them.
+type fileIndex struct {
+	sizes map[string]int64
+	paths []string
+	// symlinks and hardlinks map links to their absolute destination
+	symlinks  map[string]string
+	hardlinks map[string]string
+}
+
+// newFileIndex indexes the files of an SBOM, the extracted hardlinks of a
+// directory source are cataloged as regular files and given apart.
+func newFileIndex(archiveSbom *sbom.SBOM, extractedHardlinks map[string]string) *fileIndex {
+	index := &fileIndex{sizes: map[string]int64{}, symlinks: map[string]string{}, hardlinks: map[string]string{}}
+	for coordinates, metadata := range archiveSbom.Artifacts.FileMetadata {
+		filePath := coordinates.RealPath
+		if destination, ok := extractedHardlinks[filePath]; ok {
+			index.hardlinks[filePath] = destination
+			continue
+		}
+		switch metadata.Type {
+		case file.TypeRegular:
+			if _, ok := index.sizes[filePath]; !ok {
+				index.paths = append(index.paths, filePath)
+			}
+			index.sizes[filePath] = metadata.Size()
+		case file.TypeSymLink:
+			destination := metadata.LinkDestination
+			if !path.IsAbs(destination) {
+				destination = path.Join(path.Dir(filePath), destination)
+			}
+			index.symlinks[filePath] = destination
+		case file.TypeHardLink:
+			// hardlink destinations are relative to the root of the layer
+			index.hardlinks[filePath] = path.Join("/", metadata.LinkDestination)
+		}
+	}
+	sort.Strings(index.paths)
+	return index
+}
+
+func (index *fileIndex) fileSize(filePath string) (int64, bool) {
+	size, ok := index.sizes[filePath]
+	return size, ok
+}
+
+// resolve returns the file behind filePath: symlinked directories in its
+// path are followed, e.g. /lib/x on a merged-usr system is /usr/lib/x, and a
+// hardlink is its destination. A symlink to a file is left as is, as it takes
+// no space itself.
+func (index *fileIndex) resolve(filePath string) string {
+	filePath = path.Join("/", filePath)
+	for hop := 0; hop < maxLinkHops; hop++ {
+		if destination, ok := index.hardlinks[filePath]; ok {
+			filePath = destination
+			continue
+		}
+
+		resolved := false
+		for dir := path.Dir(filePath); dir != "/"; dir = path.Dir(dir) {
+			if destination, ok := index.symlinks[dir]; ok {
+				filePath = path.Join(destination, strings.TrimPrefix(filePath, dir))
+				resolved = true
+				break
+			}
+		}
+		if !resolved {
+			return filePath
+		}
+	}
+	return filePath
+}
+
+// followSymlinks is resolve that also follows a symlink to a file, down to
+// the file it ends on.
+func (index *fileIndex) followSymlinks(filePath string) string {
+	for hop := 0; hop < maxLinkHops; hop++ {
+		filePath = index.resolve(filePath)
+		destination, ok := index.symlinks[filePath]
+		if !ok {
+			return filePath
+		}
+		filePath = destination
+	}
+	return filePath
+}
+
+// onDiskSize sums the sizes of the given files, a file reachable through
+// several hardlinks or symlinks is counted once.
+func (index *fileIndex) onDiskSize(filePaths []string) int64 {
+	seen := map[string]bool{}
+
+	var size int64
+	for _, filePath := range filePaths {
+		resolved := index.resolve(filePath)
+		if seen[resolved] {
+			continue
+		}
+		seen[resolved] = true
+		size += index.sizes[resolved]
+	}
+	return size
+}
+
+// treeFiles lists the files below dir, except those below excludedDir.
+func (index *fileIndex) treeFiles(dir, excludedDir string) []string {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	excludedPrefix := strings.TrimSuffix(excludedDir, "/") + "/"
+
+	var treeFiles []string
+	for i := sort.SearchStrings(index.paths, prefix); i < len(index.paths) && strings.HasPrefix(index.paths[i], prefix); i++ {
+		if excludedDir != "" && strings.HasPrefix(index.paths[i], excludedPrefix) {
+			continue
+		}
+		treeFiles = append(treeFiles, index.paths[i])
+	}
+	return treeFiles
+}
+
+// treeSize is the size of all the files below dir.
+func (index *fileIndex) treeSize(dir string) int64 {
+	var size int64
+	for _, filePath := range index.treeFiles(dir, "") {
+		size += index.sizes[filePath]
+	}
+	return size
+}
+
+// ownership splits the bytes of the image between the files owned by OS
+// packages, by language packages, and by none of them.
+func (index *fileIndex) ownership(osPackageFiles, languagePackageFiles []string) FileOwnership {
+	owners := map[string]string{}
+	for _, filePath := range languagePackageFiles {
+		owners[index.resolve(filePath)] = "language"
+	}
+	// a language package installed by the OS package manager is an OS one
+	for _, filePath := range osPackageFiles {
+		owners[index.resolve(filePath)] = "os"
+	}
+
+	ownership := FileOwnership{UnownedByDir: map[string]int64{}}
+	for _, filePath := range index.paths {
+		size := index.sizes[filePath]
+		switch owners[filePath] {
+		case "os":
+			ownership.OSPackageBytes += size
+		case "language":
+			ownership.LanguagePackageBytes += size
+		default:
+			ownership.UnownedBytes += size
+			for dir := path.Dir(filePath); dir != "/"; dir = path.Dir(dir) {
+				if strings.Count(dir, "/") <= unownedDirDepth {
+					ownership.UnownedByDir[dir] += size
+				}
+			}
+		}
+	}
+	return ownership
+}
@@ -0,0 +1,193 @@
+package analyze
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DistroRelease is the images on one release of a distro family, e.g.
+// debian 12, with the distinct base images they are built on.
+type DistroRelease struct {
+	Family  string
+	Release string
+	// Names are the pretty names the images report for the release
+	Names  []string
+	Images []string
+	// Bases are the outermost base images of the images, every one of them
+	// is stored once in the OVA
+	Bases []*BaseImage
+	Size  int64
+}
+
+// Consolidation moves the images of one base to the most shared base of
+// their distro family.
+type Consolidation struct {
+	From   *DistroRelease
+	To     *DistroRelease
+	Images []string
+	// SharedBase is the base the images would share once moved
+	SharedBase *BaseImage
+	// Savings is the size of the bases no image would need anymore
+	Savings int64
+}
+
+// DetectBaseOSFragmentation groups the images by distro family and release
+// and plans how to consolidate every family on its most shared base, the
+// largest savings first. Guest root filesystems have no base image to
+// change and are left out.
+func DetectBaseOSFragmentation(archivesStats map[string]*Stats, bases []*BaseImage) ([]*DistroRelease, []Consolidation) {
+	releasesByKey := map[string]*DistroRelease{}
+	// the images of a base can alternate between releases, a base is only
+	// counted once in each of them
+	type releaseBase struct {
+		release *DistroRelease
+		base    *BaseImage
+	}
+	seenBases := map[releaseBase]bool{}
+	var releases []*DistroRelease
+	for _, base := range bases {
+		for _, image := range baseImageNames(base) {
+			stats := archivesStats[image]
+			family, release := stats.DistroID, distroReleaseCycle(stats.DistroID, stats.DistroVersionID)
+			key := family + " " + release
+			distroRelease := releasesByKey[key]
+			if distroRelease == nil {
+				distroRelease = &DistroRelease{Family: family, Release: release}
+				releasesByKey[key] = distroRelease
+				releases = append(releases, distroRelease)
+			}
+
+			distroRelease.Images = append(distroRelease.Images, image)
+			for name := range stats.BaseOS {
+				if !slices.Contains(distroRelease.Names, name) {
+					distroRelease.Names = append(distroRelease.Names, name)
+				}
+			}
+			if !seenBases[releaseBase{distroRelease, base}] {
+				seenBases[releaseBase{distroRelease, base}] = true
+				distroRelease.Bases = append(distroRelease.Bases, base)
+				distroRelease.Size += base.Size
+			}
+		}
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		if releases[i].Family != releases[j].Family {
+			return releases[i].Family < releases[j].Family
+		}
+		return compareVersions(releases[i].Release, releases[j].Release) < 0
+	})
+	for _, distroRelease := range releases {
+		sort.Strings(distroRelease.Names)
+		sort.Strings(distroRelease.Images)
+	}
+
+	return releases, planConsolidations(releases)
+}
+
+// planConsolidations targets the base shared by the most images of every
+// family, the newest release on a tie, and moves the images of the other
+// bases of the family to it.
+func planConsolidations(releases []*DistroRelease) []Consolidation {
+	var consolidations []Consolidation
+	for start := 0; start < len(releases); {
+		end := start
+		for end < len(releases) && releases[end].Family == releases[start].Family {
+			end++
+		}
+		family := releases[start:end]
+		start = end
+		if family[0].Family == "" {
+			continue
+		}
+
+		var target *DistroRelease
+		var targetBase *BaseImage
+		for _, distroRelease := range family {
+			for _, base := range distroRelease.Bases {
+				if targetBase == nil || countBaseImages(base) >= countBaseImages(targetBase) {
+					target, targetBase = distroRelease, base
+				}
+			}
+		}
+
+		// a base spanning several releases is moved, and saved, once with
+		// the oldest of them
+		moved := map[*BaseImage]bool{}
+		for _, distroRelease := range family {
+			consolidation := Consolidation{From: distroRelease, To: target, SharedBase: targetBase}
+			for _, base := range distroRelease.Bases {
+				if base == targetBase || moved[base] {
+					continue
+				}
+				moved[base] = true
+				consolidation.Images = append(consolidation.Images, baseImageNames(base)...)
+				consolidation.Savings += base.Size
+			}
+			if len(consolidation.Images) > 0 {
+				sort.Strings(consolidation.Images)
+				consolidations = append(consolidations, consolidation)
+			}
+		}
+	}
+
+	sort.SliceStable(consolidations, func(i, j int) bool {
+		return consolidations[i].Savings > consolidations[j].Savings
+	})
+	return consolidations
+}
+
+// baseImageNames lists the images built on a base, directly or on one of
+// the bases built on it.
+func baseImageNames(base *BaseImage) []string {
+	var names []string
+	for _, image := range base.Images {
+		names = append(names, image.Name)
+	}
+	for _, derivedBase := range base.Bases {
+		names = append(names, baseImageNames(derivedBase)...)
+	}
+	return names
+}
+
+func countBaseImages(base *BaseImage) int {
+	return len(baseImageNames(base))
+}
+
+// distroReleaseCycle drops the point release from an os-release VERSION_ID,
+// e.g. alpine 3.19.1 is 3.19 and rhel 8.9 is 8. Ubuntu releases are the
+// year and month, e.g. 22.04.
+func distroReleaseCycle(distroID, versionID string) string {
+	parts := strings.Split(versionID, ".")
+	switch distroID {
+	case "alpine", "ubuntu":
+		if len(parts) > 2 {
+			parts = parts[:2]
+		}
+	default:
+		parts = parts[:1]
+	}
+	return strings.Join(parts, ".")
+}
+
+// compareVersions compares dotted versions numerically, falling back on
+// comparing the text of parts that aren't numbers.
+func compareVersions(version, otherVersion string) int {
+	parts, otherParts := strings.Split(version, "."), strings.Split(otherVersion, ".")
+	for i := 0; i < len(parts) && i < len(otherParts); i++ {
+		number, err := strconv.Atoi(parts[i])
+		otherNumber, otherErr := strconv.Atoi(otherParts[i])
+		if err != nil || otherErr != nil {
+			if comparison := strings.Compare(parts[i], otherParts[i]); comparison != 0 {
+				return comparison
+			}
+			continue
+		}
+		if number != otherNumber {
+			return number - otherNumber
+		}
+	}
+	return len(parts) - len(otherParts)
+}
@@ -0,0 +1,104 @@
+package analyze
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDistroReleaseCycle(t *testing.T) {
+	tests := []struct {
+		distroID  string
+		versionID string
+		want      string
+	}{
+		{distroID: "alpine", versionID: "3.19.1", want: "3.19"},
+		{distroID: "alpine", versionID: "3.19", want: "3.19"},
+		{distroID: "ubuntu", versionID: "22.04", want: "22.04"},
+		{distroID: "debian", versionID: "12", want: "12"},
+		{distroID: "rhel", versionID: "8.9", want: "8"},
+		{distroID: "rocky", versionID: "9.3", want: "9"},
+		{distroID: "", versionID: "", want: ""},
+	}
+	for _, test := range tests {
+		if got := distroReleaseCycle(test.distroID, test.versionID); got != test.want {
+			t.Errorf("distroReleaseCycle(%q, %q) = %q, want %q", test.distroID, test.versionID, got, test.want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		version      string
+		otherVersion string
+		want         int
+	}{
+		{version: "3.19", otherVersion: "3.19", want: 0},
+		{version: "3.9", otherVersion: "3.19", want: -1},
+		{version: "12", otherVersion: "11", want: 1},
+		{version: "22.04", otherVersion: "22.04.1", want: -1},
+		{version: "1.2.a", otherVersion: "1.2.b", want: -1},
+		{version: "edge", otherVersion: "edge", want: 0},
+	}
+	for _, test := range tests {
+		got := compareVersions(test.version, test.otherVersion)
+		if (got < 0) != (test.want < 0) || (got > 0) != (test.want > 0) {
+			t.Errorf("compareVersions(%q, %q) = %d, want the sign of %d", test.version, test.otherVersion, got, test.want)
+		}
+	}
+}
+
+func TestDetectBaseOSFragmentationCountsBasesOnce(t *testing.T) {
+	debianStats := func(versionID string) *Stats {
+		stats := NewStats()
+		stats.DistroID, stats.DistroVersionID = "debian", versionID
+		return stats
+	}
+	archivesStats := map[string]*Stats{
+		"a.tar": debianStats("12"),
+		"b.tar": debianStats("11"),
+		"c.tar": debianStats("12"),
+		"d.tar": debianStats("12"),
+	}
+	// the images of the base and of the base built on it alternate between
+	// releases
+	derivedBase := &BaseImage{Size: 120, Images: []DerivedImage{{Name: "b.tar"}, {Name: "c.tar"}}}
+	mixedBase := &BaseImage{Size: 100, Images: []DerivedImage{{Name: "a.tar"}}, Bases: []*BaseImage{derivedBase}}
+	otherBase := &BaseImage{Size: 50, Images: []DerivedImage{{Name: "d.tar"}}}
+
+	releases, _ := DetectBaseOSFragmentation(archivesStats, []*BaseImage{mixedBase, otherBase})
+	sizes := map[string]int64{}
+	bases := map[string]int{}
+	for _, release := range releases {
+		sizes[release.Release] = release.Size
+		bases[release.Release] = len(release.Bases)
+	}
+	if sizes["12"] != 150 || bases["12"] != 2 {
+		t.Errorf("debian 12 = %d bases of %d bytes, want 2 bases of 150 bytes", bases["12"], sizes["12"])
+	}
+	if sizes["11"] != 100 || bases["11"] != 1 {
+		t.Errorf("debian 11 = %d bases of %d bytes, want 1 base of 100 bytes", bases["11"], sizes["11"])
+	}
+}
+
+func TestPlanConsolidationsMovesBasesOnce(t *testing.T) {
+	targetBase := &BaseImage{Size: 100, Images: []DerivedImage{{Name: "a.tar"}, {Name: "b.tar"}, {Name: "c.tar"}}}
+	// the images of this base are on both releases
+	spanningBase := &BaseImage{Size: 40, Images: []DerivedImage{{Name: "d.tar"}, {Name: "e.tar"}}}
+	oldBase := &BaseImage{Size: 30, Images: []DerivedImage{{Name: "f.tar"}}}
+	releases := []*DistroRelease{
+		{Family: "debian", Release: "11", Bases: []*BaseImage{spanningBase, oldBase}},
+		{Family: "debian", Release: "12", Bases: []*BaseImage{targetBase, spanningBase}},
+	}
+
+	consolidations := planConsolidations(releases)
+	if len(consolidations) != 1 {
+		t.Fatalf("planConsolidations() = %d consolidations, want 1", len(consolidations))
+	}
+	consolidation := consolidations[0]
+	if consolidation.From.Release != "11" || consolidation.To.Release != "12" || consolidation.SharedBase != targetBase {
+		t.Errorf("planConsolidations() moves from %s to %s, want from 11 to 12 on the shared base", consolidation.From.Release, consolidation.To.Release)
+	}
+	if consolidation.Savings != 70 || !slices.Equal(consolidation.Images, []string{"d.tar", "e.tar", "f.tar"}) {
+		t.Errorf("planConsolidations() = %v saving %d, want [d.tar e.tar f.tar] saving 70", consolidation.Images, consolidation.Savings)
+	}
+}
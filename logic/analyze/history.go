@@ -0,0 +1,142 @@
+package analyze
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// topPathDepth is how deep the directories a layer is broken down into go,
+// and topPathCount how many of the largest are kept.
+const (
+	topPathDepth = 3
+	topPathCount = 3
+)
+
+// classic docker builds record RUN with build arguments as
+// `|2 ARG=value OTHER=value /bin/sh -c command`
+var runWithArgsRe = regexp.MustCompile(`^\|\d+ .*?/bin/sh -c `)
+
+// LayerInstruction is a layer attributed to the Dockerfile instruction that
+// created it. Index numbers the layers of an image from 0.
+type LayerInstruction struct {
+	Index int
+	// Kind is the Dockerfile instruction, e.g. RUN or COPY, empty when the
+	// history doesn't tell
+	Kind           string
+	Instruction    string
+	DiffID         string
+	Size           int64
+	CompressedSize int64
+	TopPaths       []PathSize
+	Images         []string
+}
+
+type PathSize struct {
+	Path string
+	Size int64
+}
+
+// AttributeLayers lists the layers of an image with the instruction that
+// created them and the paths that make most of their size.
+func AttributeLayers(archiveName string, stats *Stats) []LayerInstruction {
+	var instructions []LayerInstruction
+	for i, layer := range stats.Layers {
+		kind, instruction := dockerfileInstruction(layer.CreatedBy)
+		layerInstruction := LayerInstruction{
+			Index:          i,
+			Kind:           kind,
+			Instruction:    instruction,
+			DiffID:         layer.DiffID,
+			Size:           layer.Size,
+			CompressedSize: layer.CompressedSize,
+			Images:         []string{archiveName},
+		}
+		if layer.Fingerprint != nil {
+			layerInstruction.TopPaths = topPaths(layer.Fingerprint.Files)
+		}
+		instructions = append(instructions, layerInstruction)
+	}
+	return instructions
+}
+
+// RankInstructions ranks the RUN, COPY and ADD layers of all the images by
+// their compressed size, a layer shared by several images is counted once.
+func RankInstructions(archivesStats map[string]*Stats) []LayerInstruction {
+	var archiveNames []string
+	for archiveName := range archivesStats {
+		archiveNames = append(archiveNames, archiveName)
+	}
+	sort.Strings(archiveNames)
+
+	var ranked []LayerInstruction
+	byDiffID := map[string]int{}
+	for _, archiveName := range archiveNames {
+		for _, instruction := range AttributeLayers(archiveName, archivesStats[archiveName]) {
+			// a layer without a diffID can't be matched with the ones of the
+			// other images
+			if instruction.Kind != "RUN" && instruction.Kind != "COPY" && instruction.Kind != "ADD" || instruction.DiffID == "" {
+				continue
+			}
+			if i, ok := byDiffID[instruction.DiffID]; ok {
+				// an image can have the same layer twice
+				if !slices.Contains(ranked[i].Images, archiveName) {
+					ranked[i].Images = append(ranked[i].Images, archiveName)
+				}
+				continue
+			}
+			byDiffID[instruction.DiffID] = len(ranked)
+			ranked = append(ranked, instruction)
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].CompressedSize > ranked[j].CompressedSize
+	})
+	return ranked
+}
+
+// dockerfileInstruction recovers the Dockerfile line from the created_by of
+// a history entry, as written by BuildKit or by the classic builder.
+func dockerfileInstruction(createdBy string) (kind, instruction string) {
+	instruction = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(createdBy), "# buildkit"))
+	if after, ok := strings.CutPrefix(instruction, "/bin/sh -c #(nop)"); ok {
+		instruction = strings.TrimSpace(after)
+	} else if after, ok := strings.CutPrefix(instruction, "/bin/sh -c "); ok {
+		instruction = "RUN " + after
+	} else if location := runWithArgsRe.FindStringIndex(instruction); location != nil {
+		instruction = "RUN " + instruction[location[1]:]
+	}
+
+	kind, _, _ = strings.Cut(instruction, " ")
+	switch kind = strings.ToUpper(kind); kind {
+	case "RUN", "COPY", "ADD", "WORKDIR", "USER", "ENV", "LABEL", "CMD", "ENTRYPOINT", "EXPOSE", "VOLUME", "ARG", "SHELL",
+		"ONBUILD", "HEALTHCHECK", "STOPSIGNAL":
+		return kind, instruction
+	}
+	return "", instruction
+}
+
+// topPaths sums the files of a layer by directory, topPathDepth deep, and
+// keeps the largest.
+func topPaths(files []LayerFile) []PathSize {
+	sizes := map[string]int64{}
+	for _, file := range files {
+		parts := strings.Split(file.Path, "/")
+		sizes[path.Join(parts[:min(len(parts), topPathDepth)]...)] += file.Size
+	}
+
+	var paths []PathSize
+	for filePath, size := range sizes {
+		paths = append(paths, PathSize{Path: filePath, Size: size})
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if paths[i].Size != paths[j].Size {
+			return paths[i].Size > paths[j].Size
+		}
+		return paths[i].Path < paths[j].Path
+	})
+	return paths[:min(len(paths), topPathCount)]
+}
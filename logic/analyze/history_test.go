@@ -0,0 +1,66 @@
+package analyze
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDockerfileInstruction(t *testing.T) {
+	tests := []struct {
+		createdBy       string
+		wantKind        string
+		wantInstruction string
+	}{
+		{createdBy: "RUN /bin/sh -c apk add --no-cache curl # buildkit", wantKind: "RUN", wantInstruction: "RUN /bin/sh -c apk add --no-cache curl"},
+		{createdBy: "COPY app /app # buildkit", wantKind: "COPY", wantInstruction: "COPY app /app"},
+		{createdBy: "/bin/sh -c #(nop) ADD file:4b03b5f551e3fbdf47ec609712007327828f7530cc3455c43bbcdcaf449a75a9 in / ", wantKind: "ADD",
+			wantInstruction: "ADD file:4b03b5f551e3fbdf47ec609712007327828f7530cc3455c43bbcdcaf449a75a9 in /"},
+		{createdBy: `/bin/sh -c #(nop)  CMD ["/bin/sh"]`, wantKind: "CMD", wantInstruction: `CMD ["/bin/sh"]`},
+		{createdBy: "/bin/sh -c apt-get update && apt-get install -y curl", wantKind: "RUN",
+			wantInstruction: "RUN apt-get update && apt-get install -y curl"},
+		{createdBy: "|2 VERSION=1.0 TARGETARCH=amd64 /bin/sh -c make install", wantKind: "RUN", wantInstruction: "RUN make install"},
+		{createdBy: "workdir /app", wantKind: "WORKDIR", wantInstruction: "workdir /app"},
+		{createdBy: "", wantKind: "", wantInstruction: ""},
+		{createdBy: "bazel build //app:image", wantKind: "", wantInstruction: "bazel build //app:image"},
+	}
+	for _, test := range tests {
+		kind, instruction := dockerfileInstruction(test.createdBy)
+		if kind != test.wantKind || instruction != test.wantInstruction {
+			t.Errorf("dockerfileInstruction(%q) = %q, %q, want %q, %q", test.createdBy, kind, instruction, test.wantKind, test.wantInstruction)
+		}
+	}
+}
+
+func TestRankInstructions(t *testing.T) {
+	archivesStats := map[string]*Stats{
+		"a.tar": {Layers: []Layer{
+			{DiffID: "sha256:base", CreatedBy: "ADD rootfs.tar / # buildkit", CompressedSize: 100},
+			// the same layer twice, e.g. the same COPY repeated
+			{DiffID: "sha256:copy", CreatedBy: "COPY config /etc # buildkit", CompressedSize: 10},
+			{DiffID: "sha256:copy", CreatedBy: "COPY config /etc # buildkit", CompressedSize: 10},
+			// layers without a diffID aren't matched across images
+			{CreatedBy: "RUN make # buildkit", CompressedSize: 50},
+		}},
+		"b.tar": {Layers: []Layer{
+			{DiffID: "sha256:base", CreatedBy: "ADD rootfs.tar / # buildkit", CompressedSize: 100},
+			{CreatedBy: "RUN make test # buildkit", CompressedSize: 40},
+		}},
+	}
+
+	ranked := RankInstructions(archivesStats)
+	var got []string
+	images := map[string][]string{}
+	for _, instruction := range ranked {
+		got = append(got, instruction.DiffID)
+		images[instruction.DiffID] = instruction.Images
+	}
+	if want := []string{"sha256:base", "sha256:copy"}; !slices.Equal(got, want) {
+		t.Fatalf("RankInstructions() = %v, want %v", got, want)
+	}
+	if want := []string{"a.tar", "b.tar"}; !slices.Equal(images["sha256:base"], want) {
+		t.Errorf("images of the base layer = %v, want %v", images["sha256:base"], want)
+	}
+	if want := []string{"a.tar"}; !slices.Equal(images["sha256:copy"], want) {
+		t.Errorf("images of the repeated layer = %v, want %v", images["sha256:copy"], want)
+	}
+}
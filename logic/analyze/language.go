@@ -0,0 +1,53 @@
+package analyze
+
+import (
+	"path"
+	"strings"
+
+	"github.com/anchore/syft/syft/pkg"
+)
+
+// languagePackageFiles returns the files of a language ecosystem package, found
+// from where the package was cataloged, as their metadata lists no files.
+func languagePackageFiles(currentPackage pkg.Package, files *fileIndex) []string {
+	locations := currentPackage.Locations.ToSlice()
+	if len(locations) == 0 {
+		return nil
+	}
+
+	switch metadata := currentPackage.Metadata.(type) {
+	case pkg.JavaArchive:
+		// libraries nested in another archive are part of its size
+		if metadata.VirtualPath != locations[0].RealPath {
+			return nil
+		}
+		return []string{locations[0].RealPath}
+	case pkg.PythonPackage:
+		var packageFiles []string
+		for _, record := range metadata.Files {
+			packageFiles = append(packageFiles, path.Join(metadata.SitePackagesRootPath, record.Path))
+		}
+		return packageFiles
+	case pkg.NpmPackage:
+		// dependencies installed below the package are packages of their own
+		packageDir := path.Dir(locations[0].RealPath)
+		return files.treeFiles(packageDir, path.Join(packageDir, "node_modules"))
+	case pkg.GolangBinaryBuildinfoEntry:
+		// modules are linked into the binary, which is accounted to its main module
+		if metadata.MainModule != currentPackage.Name {
+			return nil
+		}
+		return []string{locations[0].RealPath}
+	case pkg.RubyGemspec:
+		// specifications/<gem>.gemspec describes the gems/<gem> directory
+		gemspec := locations[0].RealPath
+		gemDir := path.Join(path.Dir(path.Dir(gemspec)), "gems", strings.TrimSuffix(path.Base(gemspec), ".gemspec"))
+		return append(files.treeFiles(gemDir, ""), gemspec)
+	default:
+		var packageFiles []string
+		for _, location := range locations {
+			packageFiles = append(packageFiles, location.RealPath)
+		}
+		return packageFiles
+	}
+}
@@ -0,0 +1,146 @@
+package analyze
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// LargeFileOptions filter the files of the large file finder. Globs with a
+// slash match the absolute path of a file or of one of its directories, the
+// others its name.
+type LargeFileOptions struct {
+	Top     int
+	Include []string
+	Exclude []string
+	MinSize int64
+}
+
+// LargeFile is a regular file of a layer, the layer is numbered from 0 in the
+// image, or -1 for files of the whole bundle found in several images.
+type LargeFile struct {
+	Path    string
+	Size    int64
+	Type    string
+	Layer   int
+	DiffID  string
+	Package string
+	Images  []string
+}
+
+// ValidateGlobs reports the first malformed glob.
+func ValidateGlobs(globs []string) error {
+	for _, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid glob %s: %w", glob, err)
+		}
+	}
+	return nil
+}
+
+func (options LargeFileOptions) matches(file LayerFile) bool {
+	if file.Size < options.MinSize {
+		return false
+	}
+	if len(options.Include) > 0 && !matchesAnyGlob(options.Include, file.Path) {
+		return false
+	}
+	return !matchesAnyGlob(options.Exclude, file.Path)
+}
+
+func matchesAnyGlob(globs []string, filePath string) bool {
+	for _, glob := range globs {
+		if !strings.Contains(glob, "/") {
+			if matched, _ := path.Match(glob, path.Base(filePath)); matched {
+				return true
+			}
+			continue
+		}
+		for dir := "/" + filePath; dir != "/"; dir = path.Dir(dir) {
+			if matched, _ := path.Match(glob, dir); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FindLargeFiles lists the largest files of the layers of an image, deleted
+// or overwritten by a later layer or not, since they all ship in the bundle.
+func FindLargeFiles(archiveName string, stats *Stats, options LargeFileOptions) []LargeFile {
+	owners := packageOwners(stats)
+
+	var largeFiles []LargeFile
+	for i, layer := range stats.Layers {
+		if layer.Fingerprint == nil {
+			continue
+		}
+		for _, file := range layer.Fingerprint.Files {
+			if options.matches(file) {
+				largeFiles = append(largeFiles, LargeFile{Path: file.Path, Size: file.Size, Type: file.Type, Layer: i, DiffID: layer.DiffID,
+					Package: owners[file.Path], Images: []string{archiveName}})
+			}
+		}
+	}
+	return topLargeFiles(largeFiles, options.Top)
+}
+
+// FindBundleLargeFiles lists the largest files of the distinct layers of all
+// the images, a layer shared by several images is counted once.
+func FindBundleLargeFiles(archivesStats map[string]*Stats, sharing LayerSharing, options LargeFileOptions) []LargeFile {
+	ownersByImage := map[string]map[string]string{}
+	layerIndexes := map[string]int{}
+
+	var largeFiles []LargeFile
+	for _, layer := range distinctLayers(sharing) {
+		// the owners are the ones of the first image with the layer
+		image := layer.Images[0]
+		if ownersByImage[image] == nil {
+			ownersByImage[image] = packageOwners(archivesStats[image])
+			for i, imageLayer := range archivesStats[image].Layers {
+				if _, ok := layerIndexes[image+"@"+imageLayer.DiffID]; !ok {
+					layerIndexes[image+"@"+imageLayer.DiffID] = i
+				}
+			}
+		}
+
+		layerIndex := layerIndexes[image+"@"+layer.DiffID]
+		if len(layer.Images) > 1 {
+			layerIndex = -1
+		}
+		for _, file := range layer.Fingerprint.Files {
+			if options.matches(file) {
+				largeFiles = append(largeFiles, LargeFile{Path: file.Path, Size: file.Size, Type: file.Type, Layer: layerIndex, DiffID: layer.DiffID,
+					Package: ownersByImage[image][file.Path], Images: layer.Images})
+			}
+		}
+	}
+	return topLargeFiles(largeFiles, options.Top)
+}
+
+// packageOwners maps the files of the packages of an image, relative to the
+// root like the files of the layers, to the name and version of the package.
+func packageOwners(stats *Stats) map[string]string {
+	owners := map[string]string{}
+	for identity, source := range stats.packageSources {
+		version, _ := PackageVersion(identity)
+		for _, filePath := range source.files {
+			owners[strings.TrimPrefix(filePath, "/")] = PackageName(identity) + "@" + version
+		}
+	}
+	return owners
+}
+
+func topLargeFiles(largeFiles []LargeFile, top int) []LargeFile {
+	sort.Slice(largeFiles, func(i, j int) bool {
+		if largeFiles[i].Size != largeFiles[j].Size {
+			return largeFiles[i].Size > largeFiles[j].Size
+		}
+		if largeFiles[i].Path != largeFiles[j].Path {
+			return largeFiles[i].Path < largeFiles[j].Path
+		}
+		return largeFiles[i].DiffID < largeFiles[j].DiffID
+	})
+	return largeFiles[:min(len(largeFiles), top)]
+}
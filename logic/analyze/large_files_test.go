@@ -0,0 +1,51 @@
+package analyze
+
+import "testing"
+
+func TestMatchesAnyGlob(t *testing.T) {
+	tests := []struct {
+		globs    []string
+		filePath string
+		want     bool
+	}{
+		{globs: nil, filePath: "usr/lib/libc.so.6", want: false},
+		// a glob without a / matches the name of the file
+		{globs: []string{"*.so*"}, filePath: "usr/lib/libc.so.6", want: true},
+		{globs: []string{"*.jar"}, filePath: "usr/lib/libc.so.6", want: false},
+		{globs: []string{"lib"}, filePath: "usr/lib/libc.so.6", want: false},
+		// a glob with a / matches the path or one of its directories
+		{globs: []string{"/usr/lib/*"}, filePath: "usr/lib/libc.so.6", want: true},
+		{globs: []string{"/usr"}, filePath: "usr/lib/libc.so.6", want: true},
+		{globs: []string{"/usr/*"}, filePath: "usr/lib/libc.so.6", want: true},
+		{globs: []string{"usr/lib/*"}, filePath: "usr/lib/libc.so.6", want: false},
+		{globs: []string{"/opt/*"}, filePath: "usr/lib/libc.so.6", want: false},
+		{globs: []string{"*.jar", "/usr/share/*"}, filePath: "usr/share/doc/README", want: true},
+	}
+	for _, test := range tests {
+		if got := matchesAnyGlob(test.globs, test.filePath); got != test.want {
+			t.Errorf("matchesAnyGlob(%q, %q) = %v, want %v", test.globs, test.filePath, got, test.want)
+		}
+	}
+}
+
+func TestLargeFileOptionsMatches(t *testing.T) {
+	file := LayerFile{Path: "opt/app/lib/app.jar", Size: 1000}
+	tests := []struct {
+		name    string
+		options LargeFileOptions
+		want    bool
+	}{
+		{name: "no options", options: LargeFileOptions{}, want: true},
+		{name: "min size reached", options: LargeFileOptions{MinSize: 1000}, want: true},
+		{name: "min size not reached", options: LargeFileOptions{MinSize: 1001}, want: false},
+		{name: "included", options: LargeFileOptions{Include: []string{"*.jar"}}, want: true},
+		{name: "not included", options: LargeFileOptions{Include: []string{"*.so"}}, want: false},
+		{name: "excluded", options: LargeFileOptions{Exclude: []string{"/opt/app"}}, want: false},
+		{name: "included and excluded", options: LargeFileOptions{Include: []string{"*.jar"}, Exclude: []string{"/opt/*"}}, want: false},
+	}
+	for _, test := range tests {
+		if got := test.options.matches(file); got != test.want {
+			t.Errorf("%s: matches(%q) = %v, want %v", test.name, file.Path, got, test.want)
+		}
+	}
+}
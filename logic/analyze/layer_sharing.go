@@ -0,0 +1,197 @@
+package analyze
+
+import (
+	"slices"
+	"sort"
+)
+
+// SharedLayer is a layer blob of the bundle with the images referencing it,
+// the bundle stores it once whatever the number of images.
+type SharedLayer struct {
+	Digest           string
+	DiffID           string
+	CompressedSize   int64
+	UncompressedSize int64
+	Images           []string
+	Fingerprint      *LayerFingerprint
+}
+
+// ImageLayerSharing splits the bytes of the layers of an image between the
+// ones other images reference too and the exclusive ones, which are what the
+// image adds to the bundle.
+type ImageLayerSharing struct {
+	Image         string
+	TotalSize     int64
+	SharedSize    int64
+	ExclusiveSize int64
+}
+
+type LayerSharing struct {
+	// Layers are sorted by number of images, the most shared first
+	Layers []*SharedLayer
+	// Images are sorted by exclusive size, the most expensive first
+	Images []ImageLayerSharing
+	// TotalSize is the sum of the sizes of all images, StoredSize the size of
+	// their distinct layers
+	TotalSize  int64
+	StoredSize int64
+	// CompressedBlobs is false when every blob is its uncompressed layer,
+	// e.g. in docker archive bundles, the blobs of a layer can't differ then
+	CompressedBlobs bool
+}
+
+// DeduplicationRatio is how many times larger the images would be if every
+// one of them stored its own layers.
+func (sharing LayerSharing) DeduplicationRatio() float64 {
+	if sharing.StoredSize == 0 {
+		return 1
+	}
+	return float64(sharing.TotalSize) / float64(sharing.StoredSize)
+}
+
+// AnalyzeLayerSharing compares the layer blobs of the images, sized as
+// compressed in the bundle. Guest root filesystems have no layers.
+func AnalyzeLayerSharing(archivesStats map[string]*Stats) LayerSharing {
+	var archiveNames []string
+	for archiveName := range archivesStats {
+		archiveNames = append(archiveNames, archiveName)
+	}
+	sort.Strings(archiveNames)
+
+	var sharing LayerSharing
+	layersByDigest := map[string]*SharedLayer{}
+	for _, archiveName := range archiveNames {
+		for _, layer := range archivesStats[archiveName].Layers {
+			sharedLayer := layersByDigest[layer.BlobDigest]
+			if sharedLayer == nil {
+				sharedLayer = &SharedLayer{
+					Digest:           layer.BlobDigest,
+					DiffID:           layer.DiffID,
+					CompressedSize:   layer.CompressedSize,
+					UncompressedSize: layer.Size,
+					Fingerprint:      layer.Fingerprint,
+				}
+				layersByDigest[layer.BlobDigest] = sharedLayer
+				if layer.DiffID != "" && layer.BlobDigest != layer.DiffID {
+					sharing.CompressedBlobs = true
+				}
+				sharing.Layers = append(sharing.Layers, sharedLayer)
+				sharing.StoredSize += layer.CompressedSize
+			}
+			// an image can have the same layer twice, e.g. an empty one
+			if n := len(sharedLayer.Images); n == 0 || sharedLayer.Images[n-1] != archiveName {
+				sharedLayer.Images = append(sharedLayer.Images, archiveName)
+			}
+		}
+	}
+
+	for _, archiveName := range archiveNames {
+		stats := archivesStats[archiveName]
+		if len(stats.Layers) == 0 {
+			continue
+		}
+
+		imageSharing := ImageLayerSharing{Image: archiveName}
+		counted := map[string]bool{}
+		for _, layer := range stats.Layers {
+			if counted[layer.BlobDigest] {
+				continue
+			}
+			counted[layer.BlobDigest] = true
+
+			imageSharing.TotalSize += layer.CompressedSize
+			if len(layersByDigest[layer.BlobDigest].Images) > 1 {
+				imageSharing.SharedSize += layer.CompressedSize
+			} else {
+				imageSharing.ExclusiveSize += layer.CompressedSize
+			}
+		}
+		sharing.TotalSize += imageSharing.TotalSize
+		sharing.Images = append(sharing.Images, imageSharing)
+	}
+
+	sort.SliceStable(sharing.Layers, func(i, j int) bool {
+		if len(sharing.Layers[i].Images) != len(sharing.Layers[j].Images) {
+			return len(sharing.Layers[i].Images) > len(sharing.Layers[j].Images)
+		}
+		return sharing.Layers[i].CompressedSize > sharing.Layers[j].CompressedSize
+	})
+	sort.SliceStable(sharing.Images, func(i, j int) bool {
+		return sharing.Images[i].ExclusiveSize > sharing.Images[j].ExclusiveSize
+	})
+	return sharing
+}
+
+// RecompressedLayer is an uncompressed layer the bundle stores under several
+// compressed blobs, e.g. the same base layer built with different gzip levels.
+type RecompressedLayer struct {
+	DiffID string
+	// Blobs are sorted by number of images, the blob to keep first
+	Blobs []*SharedLayer
+	// WastedSize is the size of the blobs other than the one to keep
+	WastedSize int64
+}
+
+// DetectRecompressedLayers compares the diffIDs of the image configs with
+// the blob digests of the manifests, the largest waste first.
+func DetectRecompressedLayers(sharing LayerSharing) []RecompressedLayer {
+	blobsByDiffID := map[string][]*SharedLayer{}
+	for _, layer := range sharing.Layers {
+		if layer.DiffID != "" {
+			blobsByDiffID[layer.DiffID] = append(blobsByDiffID[layer.DiffID], layer)
+		}
+	}
+
+	var recompressedLayers []RecompressedLayer
+	for diffID, blobs := range blobsByDiffID {
+		if len(blobs) < 2 {
+			continue
+		}
+
+		sort.SliceStable(blobs, func(i, j int) bool {
+			if len(blobs[i].Images) != len(blobs[j].Images) {
+				return len(blobs[i].Images) > len(blobs[j].Images)
+			}
+			return blobs[i].CompressedSize < blobs[j].CompressedSize
+		})
+		recompressedLayer := RecompressedLayer{DiffID: diffID, Blobs: blobs}
+		for _, blob := range blobs[1:] {
+			recompressedLayer.WastedSize += blob.CompressedSize
+		}
+		recompressedLayers = append(recompressedLayers, recompressedLayer)
+	}
+
+	sort.Slice(recompressedLayers, func(i, j int) bool {
+		if recompressedLayers[i].WastedSize != recompressedLayers[j].WastedSize {
+			return recompressedLayers[i].WastedSize > recompressedLayers[j].WastedSize
+		}
+		return recompressedLayers[i].DiffID < recompressedLayers[j].DiffID
+	})
+	return recompressedLayers
+}
+
+// distinctLayers keeps one layer per diffID, in the order of the layers, with
+// the images of every blob of the diffID: the blobs of a recompressed layer,
+// see DetectRecompressedLayers, hold the same files. Layers without a diffID
+// are skipped, they can't be told apart.
+func distinctLayers(sharing LayerSharing) []*SharedLayer {
+	var layers []*SharedLayer
+	layersByDiffID := map[string]*SharedLayer{}
+	for _, layer := range sharing.Layers {
+		if layer.Fingerprint == nil || layer.DiffID == "" {
+			continue
+		}
+		distinctLayer := layersByDiffID[layer.DiffID]
+		if distinctLayer == nil {
+			copied := *layer
+			copied.Images = slices.Clone(layer.Images)
+			layersByDiffID[layer.DiffID] = &copied
+			layers = append(layers, &copied)
+			continue
+		}
+		distinctLayer.Images = append(distinctLayer.Images, layer.Images...)
+		sort.Strings(distinctLayer.Images)
+		distinctLayer.Images = slices.Compact(distinctLayer.Images)
+	}
+	return layers
+}
@@ -0,0 +1,97 @@
+package analyze
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+)
+
+// Layer is a layer of an image, in the order the layers are applied.
+type Layer struct {
+	// DiffID is the digest of the uncompressed layer, it does not depend on
+	// how the layer blob is compressed
+	DiffID string
+	// BlobDigest and CompressedSize are the layer blob as stored in the
+	// bundle, Size is the uncompressed layer
+	BlobDigest     string
+	CompressedSize int64
+	Size           int64
+	// CreatedBy and Created come from the history entry of the layer, when
+	// the image config has one
+	CreatedBy string
+	Created   time.Time
+	// Fingerprint is nil until FingerprintLayers reads the layer
+	Fingerprint *LayerFingerprint
+}
+
+func ReadImageLayers(individualArchivePath string) ([]Layer, error) {
+	ctx := context.Background()
+
+	ref, err := alltransports.ParseImageName(fmt.Sprintf("docker-archive:%s", individualArchivePath))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing image name: %w", err)
+	}
+
+	sysCtx := &types.SystemContext{}
+	imgSrc, err := ref.NewImageSource(ctx, sysCtx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting image source: %w", err)
+	}
+	defer imgSrc.Close()
+
+	img, err := image.FromUnparsedImage(ctx, sysCtx, image.UnparsedInstance(imgSrc, nil))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing manifest for image: %w", err)
+	}
+
+	imgInspect, err := img.Inspect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error during inspect: %w", err)
+	}
+
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error reading image config: %w", err)
+	}
+
+	layers := make([]Layer, len(imgInspect.LayersData))
+	for i, layerData := range imgInspect.LayersData {
+		// docker archives store their layers uncompressed
+		size := max(layerData.Size, 0)
+		layers[i] = Layer{BlobDigest: layerData.Digest.String(), CompressedSize: size, Size: size}
+		if i < len(config.RootFS.DiffIDs) {
+			layers[i].DiffID = config.RootFS.DiffIDs[i].String()
+		}
+	}
+
+	// history has entries for the steps that did not create a layer too
+	i := 0
+	for _, history := range config.History {
+		if history.EmptyLayer {
+			continue
+		}
+		if i == len(layers) {
+			fmt.Printf("Warn: image %s has more history entries than layers\n", individualArchivePath)
+			break
+		}
+		layers[i].CreatedBy = history.CreatedBy
+		if history.Created != nil {
+			layers[i].Created = *history.Created
+		}
+		i++
+	}
+
+	return layers, nil
+}
+
+func layersSize(layers []Layer) int64 {
+	var size int64
+	for _, layer := range layers {
+		size += layer.Size
+	}
+	return size
+}
@@ -0,0 +1,284 @@
+package analyze
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// osPackageDatabases parse the OS package databases of a layer, by path in
+// the layer, the apk one is below /usr/lib with merged /usr.
+var osPackageDatabases = map[string]func(string) map[string]string{
+	"lib/apk/db/installed":     parseApkDatabase,
+	"usr/lib/apk/db/installed": parseApkDatabase,
+	"var/lib/dpkg/status":      parseDpkgStatus,
+}
+
+// trackedPackageDatabases are the kinds of OS package databases parsed by
+// osPackageDatabases, the binary rpm and the per-package alpm ones aren't.
+var trackedPackageDatabases = map[string]bool{"apk": true, "dpkg": true}
+
+// osPackageCollector parses the OS package databases a layer writes.
+type osPackageCollector struct {
+	database bytes.Buffer
+	packages map[string]string
+}
+
+func (collector *osPackageCollector) contentWriter(header *tar.Header, entryPath string) io.Writer {
+	collector.database.Reset()
+	if header.Typeflag != tar.TypeReg || osPackageDatabases[entryPath] == nil {
+		return nil
+	}
+	return &collector.database
+}
+
+func (collector *osPackageCollector) add(entry layerEntry) {
+	parse := osPackageDatabases[entry.Path]
+	if parse == nil || entry.Header.Typeflag != tar.TypeReg {
+		return
+	}
+	if collector.packages == nil {
+		collector.packages = map[string]string{}
+	}
+	for name, version := range parse(collector.database.String()) {
+		collector.packages[name] = version
+	}
+}
+
+func (collector *osPackageCollector) finish(fingerprint *LayerFingerprint) {
+	fingerprint.OSPackages = collector.packages
+}
+
+// PackageOrigin is the layer that installed a package, numbered from 0, or -1
+// when it can't be told.
+type PackageOrigin struct {
+	Layer       int
+	DiffID      string
+	Instruction string
+	// FromBase tells if the layer comes from the base image of the image, see
+	// DetectBaseImages
+	FromBase bool
+	// Changes are the later layers that upgraded or modified the package
+	Changes []PackageChange
+}
+
+// PackageChange is a layer upgrading, modifying or removing a package
+// installed by a layer below it.
+type PackageChange struct {
+	Name        string
+	Kind        string
+	FromVersion string
+	ToVersion   string
+	Layer       int
+	Instruction string
+}
+
+const (
+	changeUpgraded = "upgraded"
+	changeModified = "modified"
+	changeRemoved  = "removed"
+)
+
+// packageSource is what tells the layer of a package: its name in the OS
+// package databases, its files and the layers syft found it in.
+type packageSource struct {
+	name     string
+	isOS     bool
+	database string
+	files    []string
+	layerIDs []string
+}
+
+// AttributePackageLayers finds the layer that installed every package of
+// an image. OS packages are followed through the database snapshot of every
+// layer, which also tells the upgrades and removals. Other packages come
+// from the first layer with one of their files, or else the layer syft
+// cataloged them from.
+func AttributePackageLayers(stats *Stats) {
+	stats.PackageOrigins = map[string]*PackageOrigin{}
+	if len(stats.Layers) == 0 {
+		return
+	}
+
+	instruction := func(layer int) string {
+		_, text := dockerfileInstruction(stats.Layers[layer].CreatedBy)
+		return text
+	}
+
+	// OS package database snapshots, layer by layer
+	introduced := map[string]int{}
+	changes := map[string][]PackageChange{}
+	var installed map[string]string
+	for i, layer := range stats.Layers {
+		if layer.Fingerprint == nil || layer.Fingerprint.OSPackages == nil {
+			continue
+		}
+
+		snapshot := layer.Fingerprint.OSPackages
+		for name, version := range snapshot {
+			previousVersion, ok := installed[name]
+			if !ok {
+				introduced[name] = i
+			} else if previousVersion != version {
+				changes[name] = append(changes[name], PackageChange{Name: name, Kind: changeUpgraded, FromVersion: previousVersion,
+					ToVersion: version, Layer: i, Instruction: instruction(i)})
+			}
+		}
+		for name, version := range installed {
+			if _, ok := snapshot[name]; !ok {
+				changes[name] = append(changes[name], PackageChange{Name: name, Kind: changeRemoved, FromVersion: version,
+					Layer: i, Instruction: instruction(i)})
+			}
+		}
+		installed = snapshot
+	}
+
+	stats.RemovedPackages = nil
+	for name, packageChanges := range changes {
+		if _, ok := installed[name]; ok {
+			continue
+		}
+		for _, change := range packageChanges {
+			if change.Kind == changeRemoved {
+				stats.RemovedPackages = append(stats.RemovedPackages, change)
+			}
+		}
+	}
+	sort.Slice(stats.RemovedPackages, func(i, j int) bool {
+		if stats.RemovedPackages[i].Layer != stats.RemovedPackages[j].Layer {
+			return stats.RemovedPackages[i].Layer < stats.RemovedPackages[j].Layer
+		}
+		return stats.RemovedPackages[i].Name < stats.RemovedPackages[j].Name
+	})
+
+	// the layers every regular file is found in, in order, with its content
+	type fileVersion struct {
+		layer  int
+		digest [32]byte
+	}
+	fileLayers := map[string][]fileVersion{}
+	layerIndexes := map[string]int{}
+	for i, layer := range stats.Layers {
+		if _, ok := layerIndexes[layer.DiffID]; !ok {
+			layerIndexes[layer.DiffID] = i
+		}
+		if layer.Fingerprint == nil {
+			continue
+		}
+		for _, file := range layer.Fingerprint.Files {
+			fileLayers[file.Path] = append(fileLayers[file.Path], fileVersion{layer: i, digest: file.Digest})
+		}
+	}
+
+	stats.UntrackedPackageDatabases = nil
+	for _, source := range stats.packageSources {
+		if source.isOS && !trackedPackageDatabases[source.database] && !slices.Contains(stats.UntrackedPackageDatabases, source.database) {
+			stats.UntrackedPackageDatabases = append(stats.UntrackedPackageDatabases, source.database)
+		}
+	}
+	sort.Strings(stats.UntrackedPackageDatabases)
+
+	for identity, source := range stats.packageSources {
+		origin := &PackageOrigin{Layer: -1}
+		if layer, ok := introduced[source.name]; ok && source.isOS {
+			origin.Layer = layer
+			origin.Changes = changes[source.name]
+		} else {
+			lastModified := -1
+			for _, filePath := range source.files {
+				versions := fileLayers[strings.TrimPrefix(filePath, "/")]
+				if len(versions) == 0 {
+					continue
+				}
+				if origin.Layer == -1 || versions[0].layer < origin.Layer {
+					origin.Layer = versions[0].layer
+				}
+				for _, version := range versions[1:] {
+					if version.digest != versions[0].digest {
+						lastModified = max(lastModified, version.layer)
+					}
+				}
+			}
+			if origin.Layer == -1 {
+				for _, layerID := range source.layerIDs {
+					if layer, ok := layerIndexes[layerID]; ok && (origin.Layer == -1 || layer < origin.Layer) {
+						origin.Layer = layer
+					}
+				}
+			}
+			if lastModified > origin.Layer && origin.Layer != -1 {
+				origin.Changes = append(origin.Changes, PackageChange{Name: source.name, Kind: changeModified, Layer: lastModified,
+					Instruction: instruction(lastModified)})
+			}
+		}
+
+		if origin.Layer != -1 {
+			origin.DiffID = stats.Layers[origin.Layer].DiffID
+			origin.Instruction = instruction(origin.Layer)
+			origin.FromBase = origin.Layer < stats.BaseLayers
+		}
+		stats.PackageOrigins[identity] = origin
+	}
+}
+
+// parseApkDatabase reads the package (P:) and version (V:) of every entry of
+// an apk installed database.
+func parseApkDatabase(database string) map[string]string {
+	packages := map[string]string{}
+	for _, entry := range strings.Split(database, "\n\n") {
+		name, version := "", ""
+		for _, line := range strings.Split(entry, "\n") {
+			if value, ok := strings.CutPrefix(line, "P:"); ok {
+				name = value
+			} else if value, ok := strings.CutPrefix(line, "V:"); ok {
+				version = value
+			}
+		}
+		if name != "" {
+			packages[name] = version
+		}
+	}
+	return packages
+}
+
+// parseDpkgStatus reads the installed packages of a dpkg status database,
+// packages removed but with their configuration files left aren't. They are
+// keyed by name and architecture, see dpkgPackageKey.
+func parseDpkgStatus(database string) map[string]string {
+	packages := map[string]string{}
+	for _, entry := range strings.Split(database, "\n\n") {
+		name, architecture, version, status := "", "", "", ""
+		for _, line := range strings.Split(entry, "\n") {
+			key, value, found := strings.Cut(line, ":")
+			if !found {
+				continue
+			}
+			switch key {
+			case "Package":
+				name = strings.TrimSpace(value)
+			case "Architecture":
+				architecture = strings.TrimSpace(value)
+			case "Version":
+				version = strings.TrimSpace(value)
+			case "Status":
+				status = strings.TrimSpace(value)
+			}
+		}
+		if name != "" && slices.Contains(strings.Fields(status), "installed") {
+			packages[dpkgPackageKey(name, architecture)] = version
+		}
+	}
+	return packages
+}
+
+// dpkgPackageKey tells apart the architectures of a package installed with
+// multiarch, e.g. libc6:amd64 and libc6:i386, like dpkg-query does.
+func dpkgPackageKey(name, architecture string) string {
+	if architecture == "" {
+		return name
+	}
+	return name + ":" + architecture
+}
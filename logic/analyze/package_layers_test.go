@@ -0,0 +1,129 @@
+package analyze
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParseApkDatabase(t *testing.T) {
+	tests := []struct {
+		name     string
+		database string
+		want     map[string]string
+	}{
+		{name: "empty", database: "", want: map[string]string{}},
+		{
+			name: "packages",
+			database: "C:Q1abc=\nP:musl\nV:1.2.4-r2\nA:x86_64\nS:383152\nI:622592\nF:lib\nR:ld-musl-x86_64.so.1\n\n" +
+				"C:Q1def=\nP:busybox\nV:1.36.1-r15\nA:x86_64\nF:bin\nR:busybox\n\n",
+			want: map[string]string{"musl": "1.2.4-r2", "busybox": "1.36.1-r15"},
+		},
+		{
+			name:     "no trailing blank line",
+			database: "P:musl\nV:1.2.4-r2\n\nP:zlib\nV:1.3.1-r0",
+			want:     map[string]string{"musl": "1.2.4-r2", "zlib": "1.3.1-r0"},
+		},
+		{
+			name:     "entry without a name",
+			database: "V:1.0\nA:x86_64\n\nP:musl\nV:1.2.4-r2\n",
+			want:     map[string]string{"musl": "1.2.4-r2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseApkDatabase(test.database); !maps.Equal(got, test.want) {
+				t.Errorf("parseApkDatabase() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseDpkgStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		database string
+		want     map[string]string
+	}{
+		{name: "empty", database: "", want: map[string]string{}},
+		{
+			name: "installed",
+			database: "Package: libc6\nStatus: install ok installed\nPriority: optional\nVersion: 2.36-9+deb12u4\n" +
+				"Description: GNU C Library: Shared libraries\n Contains the standard libraries: libc.so.6\n\n" +
+				"Package: curl\nStatus: install ok installed\nVersion: 7.88.1-10+deb12u5\n",
+			want: map[string]string{"libc6": "2.36-9+deb12u4", "curl": "7.88.1-10+deb12u5"},
+		},
+		{
+			name: "removed with configuration files left",
+			database: "Package: vim\nStatus: deinstall ok config-files\nVersion: 2:9.0.1378-2\n\n" +
+				"Package: nano\nStatus: install ok installed\nVersion: 7.2-1\n",
+			want: map[string]string{"nano": "7.2-1"},
+		},
+		{
+			name:     "half installed",
+			database: "Package: openssl\nStatus: install reinstreq half-installed\nVersion: 3.0.11-1~deb12u2\n",
+			want:     map[string]string{},
+		},
+		{
+			name: "multiarch",
+			database: "Package: libc6\nStatus: install ok installed\nArchitecture: amd64\nVersion: 2.36-9\n\n" +
+				"Package: libc6\nStatus: install ok installed\nArchitecture: i386\nMulti-Arch: same\nVersion: 2.36-9\n\n" +
+				"Package: tzdata\nStatus: install ok installed\nArchitecture: all\nVersion: 2024a-0+deb12u1\n",
+			want: map[string]string{"libc6:amd64": "2.36-9", "libc6:i386": "2.36-9", "tzdata:all": "2024a-0+deb12u1"},
+		},
+		{
+			name:     "epoch in the version",
+			database: "Package: vim\nStatus: install ok installed\nVersion: 2:9.0.1378-2\n",
+			want:     map[string]string{"vim": "2:9.0.1378-2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseDpkgStatus(test.database); !maps.Equal(got, test.want) {
+				t.Errorf("parseDpkgStatus() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAttributePackageLayers(t *testing.T) {
+	layer := func(osPackages map[string]string) Layer {
+		return Layer{Fingerprint: &LayerFingerprint{OSPackages: osPackages}}
+	}
+	stats := &Stats{
+		Layers: []Layer{
+			layer(map[string]string{"libc6:amd64": "2.36-9"}),
+			layer(map[string]string{"libc6:amd64": "2.36-9+deb12u4", "libc6:i386": "2.36-9+deb12u4"}),
+		},
+		BaseLayers: 1,
+		packageSources: map[string]packageSource{
+			"pkg:deb/debian/libc6@2.36-9+deb12u4?arch=amd64": {name: "libc6:amd64", isOS: true, database: "dpkg"},
+			"pkg:deb/debian/libc6@2.36-9+deb12u4?arch=i386":  {name: "libc6:i386", isOS: true, database: "dpkg"},
+			"pkg:rpm/redhat/bash@5.1.8":                      {name: "bash", isOS: true, database: "rpm"},
+			"pkg:npm/left-pad@1.3.0":                         {name: "left-pad"},
+		},
+	}
+
+	AttributePackageLayers(stats)
+
+	tests := []struct {
+		identity    string
+		wantLayer   int
+		wantChanges int
+	}{
+		// the amd64 package was upgraded, the i386 one added by the next layer
+		{identity: "pkg:deb/debian/libc6@2.36-9+deb12u4?arch=amd64", wantLayer: 0, wantChanges: 1},
+		{identity: "pkg:deb/debian/libc6@2.36-9+deb12u4?arch=i386", wantLayer: 1, wantChanges: 0},
+		{identity: "pkg:rpm/redhat/bash@5.1.8", wantLayer: -1, wantChanges: 0},
+	}
+	for _, test := range tests {
+		origin := stats.PackageOrigins[test.identity]
+		if origin.Layer != test.wantLayer || len(origin.Changes) != test.wantChanges {
+			t.Errorf("AttributePackageLayers() %s = layer %d with %d changes, want layer %d with %d changes",
+				test.identity, origin.Layer, len(origin.Changes), test.wantLayer, test.wantChanges)
+		}
+	}
+	if want := []string{"rpm"}; !slices.Equal(stats.UntrackedPackageDatabases, want) {
+		t.Errorf("AttributePackageLayers() untracked databases = %v, want %v", stats.UntrackedPackageDatabases, want)
+	}
+}
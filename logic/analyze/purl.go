@@ -0,0 +1,52 @@
+package analyze
+
+import (
+	"github.com/anchore/packageurl-go"
+	"github.com/anchore/syft/syft/pkg"
+)
+
+// packageIdentity is the purl of a package reduced to its type, namespace,
+// name, version and distro qualifier, so that the same build of a package
+// has the same identity in every image.
+func packageIdentity(currentPackage pkg.Package) string {
+	purl, err := packageurl.FromString(currentPackage.PURL)
+	if err != nil || currentPackage.PURL == "" {
+		return packageurl.NewPackageURL("generic", "", currentPackage.Name, currentPackage.Version, nil, "").ToString()
+	}
+
+	var qualifiers packageurl.Qualifiers
+	if distro, ok := purl.Qualifiers.Map()["distro"]; ok {
+		qualifiers = packageurl.QualifiersFromMap(map[string]string{"distro": distro})
+	}
+
+	return packageurl.NewPackageURL(purl.Type, purl.Namespace, purl.Name, purl.Version, qualifiers, "").ToString()
+}
+
+// PackageName returns the name of a package identity.
+func PackageName(identity string) string {
+	purl, err := packageurl.FromString(identity)
+	if err != nil {
+		return identity
+	}
+	return purl.Name
+}
+
+// PackageVersion returns the version and distro qualifier of a package
+// identity.
+func PackageVersion(identity string) (version, distro string) {
+	purl, err := packageurl.FromString(identity)
+	if err != nil {
+		return "", ""
+	}
+	return purl.Version, purl.Qualifiers.Map()["distro"]
+}
+
+// PackageEcosystem returns the purl type of a package identity, e.g. deb,
+// maven or npm.
+func PackageEcosystem(identity string) string {
+	purl, err := packageurl.FromString(identity)
+	if err != nil {
+		return ""
+	}
+	return purl.Type
+}
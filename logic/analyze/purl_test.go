@@ -0,0 +1,80 @@
+package analyze
+
+import (
+	"testing"
+
+	"github.com/anchore/syft/syft/pkg"
+)
+
+func TestPackageIdentity(t *testing.T) {
+	tests := []struct {
+		name string
+		pkg  pkg.Package
+		want string
+	}{
+		{
+			// the arch and upstream qualifiers don't make another build
+			name: "deb",
+			pkg:  pkg.Package{Name: "libc6", Version: "2.36-9", PURL: "pkg:deb/debian/libc6@2.36-9?arch=amd64&upstream=glibc&distro=debian-12"},
+			want: "pkg:deb/debian/libc6@2.36-9?distro=debian-12",
+		},
+		{
+			name: "apk",
+			pkg:  pkg.Package{Name: "musl", Version: "1.2.4-r2", PURL: "pkg:apk/alpine/musl@1.2.4-r2?arch=x86_64&distro=alpine-3.18.4"},
+			want: "pkg:apk/alpine/musl@1.2.4-r2?distro=alpine-3.18.4",
+		},
+		{
+			name: "maven",
+			pkg:  pkg.Package{Name: "guava", Version: "32.1.2-jre", PURL: "pkg:maven/com.google.guava/guava@32.1.2-jre"},
+			want: "pkg:maven/com.google.guava/guava@32.1.2-jre",
+		},
+		{
+			name: "npm scope",
+			pkg:  pkg.Package{Name: "@babel/core", Version: "7.23.0", PURL: "pkg:npm/%40babel/core@7.23.0"},
+			want: "pkg:npm/%40babel/core@7.23.0",
+		},
+		{
+			name: "no purl",
+			pkg:  pkg.Package{Name: "app", Version: "1.0"},
+			want: "pkg:generic/app@1.0",
+		},
+		{
+			name: "invalid purl",
+			pkg:  pkg.Package{Name: "app", Version: "1.0", PURL: "not a purl"},
+			want: "pkg:generic/app@1.0",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := packageIdentity(test.pkg); got != test.want {
+				t.Errorf("packageIdentity(%q) = %q, want %q", test.pkg.PURL, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPackageIdentityParts(t *testing.T) {
+	tests := []struct {
+		identity      string
+		wantName      string
+		wantVersion   string
+		wantDistro    string
+		wantEcosystem string
+	}{
+		{identity: "pkg:deb/debian/libc6@2.36-9?distro=debian-12", wantName: "libc6", wantVersion: "2.36-9", wantDistro: "debian-12", wantEcosystem: "deb"},
+		{identity: "pkg:maven/com.google.guava/guava@32.1.2-jre", wantName: "guava", wantVersion: "32.1.2-jre", wantEcosystem: "maven"},
+		{identity: "pkg:npm/%40babel/core@7.23.0", wantName: "core", wantVersion: "7.23.0", wantEcosystem: "npm"},
+		{identity: "not a purl", wantName: "not a purl"},
+	}
+	for _, test := range tests {
+		if got := PackageName(test.identity); got != test.wantName {
+			t.Errorf("PackageName(%q) = %q, want %q", test.identity, got, test.wantName)
+		}
+		if version, distro := PackageVersion(test.identity); version != test.wantVersion || distro != test.wantDistro {
+			t.Errorf("PackageVersion(%q) = %q, %q, want %q, %q", test.identity, version, distro, test.wantVersion, test.wantDistro)
+		}
+		if got := PackageEcosystem(test.identity); got != test.wantEcosystem {
+			t.Errorf("PackageEcosystem(%q) = %q, want %q", test.identity, got, test.wantEcosystem)
+		}
+	}
+}
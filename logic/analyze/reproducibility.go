@@ -0,0 +1,325 @@
+package analyze
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// The tar entry fields that make layers with the same files differ.
+const (
+	fieldMtime      = "mtime"
+	fieldOwnerIDs   = "uid/gid"
+	fieldOwnerNames = "owner names"
+	fieldMode       = "mode"
+	fieldXattrs     = "xattrs"
+	fieldOrder      = "entry order"
+)
+
+// paxXattrPrefix is the prefix of the PAX records holding extended attributes.
+const paxXattrPrefix = "SCHILY.xattr."
+
+var metadataFields = []string{fieldMtime, fieldOwnerIDs, fieldOwnerNames, fieldMode, fieldXattrs, fieldOrder}
+
+// LayerFingerprint digests the files of a layer apart from their metadata,
+// and every metadata field apart from the rest.
+type LayerFingerprint struct {
+	ContentDigest   string
+	MetadataDigests map[string]string
+	// Files are the regular files of the layer, sorted by path
+	Files []LayerFile
+	// Whiteouts are the paths the layer deletes from the layers below it and
+	// OpaqueDirs the directories it empties, the root directory is ""
+	Whiteouts  []string
+	OpaqueDirs []string
+	// Dirs are the directories of the layer and Links its other entries
+	// that aren't regular files, e.g. symlinks and hardlinks, they replace
+	// a file of the layers below at their path too
+	Dirs  []string
+	Links []string
+	// OSPackages are the names and versions of the packages in the OS package
+	// database the layer writes, nil when it doesn't write one
+	OSPackages map[string]string
+}
+
+// LayerFile is a regular file of a layer, Digest is the sha256 of its
+// content and Type is detected from its first bytes.
+type LayerFile struct {
+	Path   string
+	Digest [sha256.Size]byte
+	Size   int64
+	Type   string
+}
+
+// NonReproducibleLayer is layers with the same files that only differ in
+// metadata, they would be one layer built reproducibly.
+type NonReproducibleLayer struct {
+	ContentDigest string
+	// Layers are sorted by number of images, the layer to keep first
+	Layers []*SharedLayer
+	// DifferingFields are the fields every other layer differs from the
+	// layer to keep in, by diffID
+	DifferingFields map[string][]string
+	// DedupableSize is the compressed size of the layers other than the one
+	// to keep
+	DedupableSize int64
+}
+
+// FingerprintLayers reads the tar entries of the distinct layers of the
+// images, a layer shared by several images is read once.
+func FingerprintLayers(archivesStats map[string]*Stats) error {
+	fingerprints := map[string]*LayerFingerprint{}
+	for archiveName, stats := range archivesStats {
+		var missing []Layer
+		for _, layer := range stats.Layers {
+			if _, ok := fingerprints[layer.DiffID]; !ok && layer.DiffID != "" {
+				missing = append(missing, layer)
+			}
+		}
+		if len(missing) > 0 {
+			if err := fingerprintArchiveLayers(archiveName, missing, fingerprints); err != nil {
+				return fmt.Errorf("error reading layers of %s: %w", archiveName, err)
+			}
+		}
+	}
+
+	for _, stats := range archivesStats {
+		for i, layer := range stats.Layers {
+			stats.Layers[i].Fingerprint = fingerprints[layer.DiffID]
+		}
+	}
+	return nil
+}
+
+func fingerprintArchiveLayers(individualArchivePath string, layers []Layer, fingerprints map[string]*LayerFingerprint) error {
+	ctx := context.Background()
+
+	ref, err := alltransports.ParseImageName(fmt.Sprintf("docker-archive:%s", individualArchivePath))
+	if err != nil {
+		return fmt.Errorf("error parsing image name: %w", err)
+	}
+
+	imgSrc, err := ref.NewImageSource(ctx, &types.SystemContext{})
+	if err != nil {
+		return fmt.Errorf("error getting image source: %w", err)
+	}
+	defer imgSrc.Close()
+
+	for _, layer := range layers {
+		// docker archives look their layers up by diffID
+		blob, _, err := imgSrc.GetBlob(ctx, types.BlobInfo{Digest: digest.Digest(layer.DiffID), Size: -1}, none.NoCache)
+		if err != nil {
+			return fmt.Errorf("error reading layer %s: %w", layer.DiffID, err)
+		}
+		fingerprint, err := fingerprintLayer(blob)
+		blob.Close()
+		if err != nil {
+			return fmt.Errorf("error reading layer %s: %w", layer.DiffID, err)
+		}
+		fingerprints[layer.DiffID] = fingerprint
+	}
+	return nil
+}
+
+// layerEntry is a tar entry of a layer as the collectors of its fingerprint
+// see it: Path is cleaned and relative to the root of the layer, Head is the
+// beginning of the content, up to fileHeadSize bytes, and Digest the sha256
+// of the whole content.
+type layerEntry struct {
+	Header *tar.Header
+	Path   string
+	Head   []byte
+	Digest [sha256.Size]byte
+}
+
+// layerCollector gathers a part of the fingerprint of a layer from its
+// entries, in the order of the layer tar.
+type layerCollector interface {
+	// contentWriter is where the content of an entry is copied to, nil when
+	// the collector only needs its head and digest
+	contentWriter(header *tar.Header, entryPath string) io.Writer
+	add(entry layerEntry)
+	// finish fills the fingerprint, in the order of the collectors
+	finish(fingerprint *LayerFingerprint)
+}
+
+// newLayerCollectors lists the collectors of a layer fingerprint, the file
+// types are set on the files once they are listed.
+func newLayerCollectors() []layerCollector {
+	return []layerCollector{
+		&reproducibilityCollector{},
+		&fileListCollector{},
+		&fileTypeCollector{types: map[string]string{}},
+		&wasteCollector{},
+		&osPackageCollector{},
+	}
+}
+
+// fingerprintLayer reads the entries of a layer tar once and hands every
+// one of them to the collectors of the fingerprint.
+func fingerprintLayer(layerTar io.Reader) (*LayerFingerprint, error) {
+	collectors := newLayerCollectors()
+
+	tarReader := tar.NewReader(layerTar)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entry := layerEntry{Header: header, Path: strings.TrimPrefix(path.Clean("/"+header.Name), "/")}
+		contentHash := sha256.New()
+		writers := []io.Writer{contentHash}
+		for _, collector := range collectors {
+			if writer := collector.contentWriter(header, entry.Path); writer != nil {
+				writers = append(writers, writer)
+			}
+		}
+		content := io.MultiWriter(writers...)
+
+		head := make([]byte, fileHeadSize)
+		headLength, err := io.ReadFull(tarReader, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		entry.Head = head[:headLength]
+		content.Write(entry.Head)
+		if _, err := io.Copy(content, tarReader); err != nil {
+			return nil, err
+		}
+		entry.Digest = [sha256.Size]byte(contentHash.Sum(nil))
+
+		for _, collector := range collectors {
+			collector.add(entry)
+		}
+	}
+
+	fingerprint := &LayerFingerprint{}
+	for _, collector := range collectors {
+		collector.finish(fingerprint)
+	}
+	return fingerprint, nil
+}
+
+// reproducibilityCollector digests the entries sorted by path, so that the
+// order of the entries only changes the digest of the order.
+type reproducibilityCollector struct {
+	entries []reproducibilityEntry
+}
+
+type reproducibilityEntry struct {
+	path     string
+	content  string
+	metadata map[string]string
+}
+
+func (collector *reproducibilityCollector) contentWriter(*tar.Header, string) io.Writer {
+	return nil
+}
+
+func (collector *reproducibilityCollector) add(entry layerEntry) {
+	header := entry.Header
+	// the other PAX records (mtime, path, size...) are fields of the
+	// header, encoded in PAX when they don't fit in it
+	var xattrs []string
+	for key, value := range header.PAXRecords {
+		if strings.HasPrefix(key, paxXattrPrefix) {
+			xattrs = append(xattrs, key+"="+value)
+		}
+	}
+	sort.Strings(xattrs)
+
+	collector.entries = append(collector.entries, reproducibilityEntry{
+		path:    entry.Path,
+		content: fmt.Sprintf("%c %s %x", header.Typeflag, header.Linkname, entry.Digest),
+		metadata: map[string]string{
+			fieldMtime:      strconv.FormatInt(header.ModTime.Unix(), 10),
+			fieldOwnerIDs:   fmt.Sprintf("%d:%d", header.Uid, header.Gid),
+			fieldOwnerNames: header.Uname + ":" + header.Gname,
+			fieldMode:       strconv.FormatInt(header.Mode, 8),
+			fieldXattrs:     strings.Join(xattrs, ","),
+		},
+	})
+}
+
+func (collector *reproducibilityCollector) finish(fingerprint *LayerFingerprint) {
+	hashes := map[string]hash.Hash{}
+	for _, field := range metadataFields {
+		hashes[field] = sha256.New()
+	}
+	for _, entry := range collector.entries {
+		fmt.Fprintln(hashes[fieldOrder], entry.path)
+	}
+
+	sort.SliceStable(collector.entries, func(i, j int) bool {
+		return collector.entries[i].path < collector.entries[j].path
+	})
+	contentHash := sha256.New()
+	for _, entry := range collector.entries {
+		fmt.Fprintln(contentHash, entry.path, entry.content)
+		for field, value := range entry.metadata {
+			fmt.Fprintln(hashes[field], entry.path, value)
+		}
+	}
+
+	fingerprint.ContentDigest = hex.EncodeToString(contentHash.Sum(nil))
+	fingerprint.MetadataDigests = map[string]string{}
+	for field, hash := range hashes {
+		fingerprint.MetadataDigests[field] = hex.EncodeToString(hash.Sum(nil))
+	}
+}
+
+// DetectNonReproducibleLayers groups the distinct layers of the images by
+// the digest of their files, the largest dedupable size first.
+func DetectNonReproducibleLayers(sharing LayerSharing) []NonReproducibleLayer {
+	layersByContent := map[string][]*SharedLayer{}
+	// blobs of the same diffID are identical layers, see DetectRecompressedLayers
+	for _, layer := range distinctLayers(sharing) {
+		layersByContent[layer.Fingerprint.ContentDigest] = append(layersByContent[layer.Fingerprint.ContentDigest], layer)
+	}
+
+	var nonReproducibleLayers []NonReproducibleLayer
+	for contentDigest, layers := range layersByContent {
+		if len(layers) < 2 {
+			continue
+		}
+
+		sort.SliceStable(layers, func(i, j int) bool {
+			return len(layers[i].Images) > len(layers[j].Images)
+		})
+		nonReproducibleLayer := NonReproducibleLayer{ContentDigest: contentDigest, Layers: layers, DifferingFields: map[string][]string{}}
+		for _, layer := range layers[1:] {
+			nonReproducibleLayer.DedupableSize += layer.CompressedSize
+			for _, field := range metadataFields {
+				if layer.Fingerprint.MetadataDigests[field] != layers[0].Fingerprint.MetadataDigests[field] {
+					nonReproducibleLayer.DifferingFields[layer.DiffID] = append(nonReproducibleLayer.DifferingFields[layer.DiffID], field)
+				}
+			}
+		}
+		nonReproducibleLayers = append(nonReproducibleLayers, nonReproducibleLayer)
+	}
+
+	sort.Slice(nonReproducibleLayers, func(i, j int) bool {
+		if nonReproducibleLayers[i].DedupableSize != nonReproducibleLayers[j].DedupableSize {
+			return nonReproducibleLayers[i].DedupableSize > nonReproducibleLayers[j].DedupableSize
+		}
+		return nonReproducibleLayers[i].ContentDigest < nonReproducibleLayers[j].ContentDigest
+	})
+	return nonReproducibleLayers
+}
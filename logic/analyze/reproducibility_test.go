@@ -0,0 +1,134 @@
+package analyze
+
+import (
+	"archive/tar"
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testTarEntry struct {
+	name    string
+	content string
+	modTime time.Time
+	uid     int
+	xattrs  map[string]string
+	// format defaults to PAX and typeflag to a regular file
+	format   tar.Format
+	typeflag byte
+	linkname string
+}
+
+func makeTestTar(t *testing.T, entries []testTarEntry) *bytes.Buffer {
+	t.Helper()
+	var buffer bytes.Buffer
+	tarWriter := tar.NewWriter(&buffer)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Size: int64(len(entry.content)), Mode: 0644, Typeflag: tar.TypeReg,
+			ModTime: entry.modTime, Uid: entry.uid, Format: tar.FormatPAX}
+		if entry.format != tar.FormatUnknown {
+			header.Format = entry.format
+		}
+		if entry.typeflag != 0 {
+			header.Typeflag, header.Linkname = entry.typeflag, entry.linkname
+		}
+		for key, value := range entry.xattrs {
+			if header.PAXRecords == nil {
+				header.PAXRecords = map[string]string{}
+			}
+			header.PAXRecords[paxXattrPrefix+key] = value
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buffer
+}
+
+func TestFingerprintLayerDifferingFields(t *testing.T) {
+	modTime := time.Unix(1700000000, 0)
+	base := []testTarEntry{
+		{name: "app/bin", content: "binary", modTime: modTime},
+		{name: "app/config", content: "config", modTime: modTime},
+	}
+	longName := "app/" + strings.Repeat("d", 120) + "/bin"
+	change := func(change func(entries []testTarEntry) []testTarEntry) []testTarEntry {
+		return change(slices.Clone(base))
+	}
+
+	tests := []struct {
+		name    string
+		entries []testTarEntry
+		// reference defaults to base
+		reference []testTarEntry
+		want      []string
+	}{
+		{name: "identical", entries: base, want: nil},
+		{name: "sub-second mtime", entries: change(func(entries []testTarEntry) []testTarEntry {
+			entries[0].modTime = modTime.Add(500 * time.Millisecond)
+			return entries
+		}), want: nil},
+		// a long name is encoded in a PAX path record, compared to the same
+		// name in a GNU long name entry
+		{name: "long name", entries: []testTarEntry{
+			{name: longName, content: "binary", modTime: modTime},
+		}, reference: []testTarEntry{
+			{name: longName, content: "binary", modTime: modTime, format: tar.FormatGNU},
+		}, want: nil},
+		{name: "dot slash names", entries: change(func(entries []testTarEntry) []testTarEntry {
+			entries[0].name = "./" + entries[0].name
+			entries[1].name = "./" + entries[1].name
+			return entries
+		}), want: nil},
+		{name: "mtime", entries: change(func(entries []testTarEntry) []testTarEntry {
+			entries[0].modTime = modTime.Add(time.Hour)
+			return entries
+		}), want: []string{fieldMtime}},
+		{name: "uid", entries: change(func(entries []testTarEntry) []testTarEntry {
+			entries[1].uid = 1000
+			return entries
+		}), want: []string{fieldOwnerIDs}},
+		{name: "xattrs", entries: change(func(entries []testTarEntry) []testTarEntry {
+			entries[0].xattrs = map[string]string{"security.capability": "cap"}
+			return entries
+		}), want: []string{fieldXattrs}},
+		{name: "entry order", entries: []testTarEntry{base[1], base[0]}, want: []string{fieldOrder}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reference := test.reference
+			if reference == nil {
+				reference = base
+			}
+			referenceFingerprint, err := fingerprintLayer(makeTestTar(t, reference))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fingerprint, err := fingerprintLayer(makeTestTar(t, test.entries))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fingerprint.ContentDigest != referenceFingerprint.ContentDigest {
+				t.Fatalf("content digests differ")
+			}
+			var differing []string
+			for _, field := range metadataFields {
+				if fingerprint.MetadataDigests[field] != referenceFingerprint.MetadataDigests[field] {
+					differing = append(differing, field)
+				}
+			}
+			if !slices.Equal(differing, test.want) {
+				t.Errorf("differing fields = %v, want %v", differing, test.want)
+			}
+		})
+	}
+}
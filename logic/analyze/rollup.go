@@ -0,0 +1,136 @@
+package analyze
+
+import (
+	"slices"
+	"sort"
+)
+
+// sizeDiscrepancyMinBytes ignores small packages whose declared size is
+// rounded, e.g. dpkg sizes are in KiB.
+const sizeDiscrepancyMinBytes = 64 * 1024
+
+// Rollup merges the stats of all images: the Count of every entry is the
+// number of images containing it.
+type Rollup struct {
+	BaseOS map[string]*Info
+	// Packages is keyed by package identity, an entry is the same build of a
+	// package found in several images
+	Packages map[string]*Info
+	// PackagesByName merges every identity of a package under its name
+	PackagesByName map[string]*Info
+	Runtimes       map[string]*Info
+}
+
+func RollUp(archivesStats map[string]*Stats) *Rollup {
+	rollup := &Rollup{
+		BaseOS:         make(map[string]*Info),
+		Packages:       make(map[string]*Info),
+		PackagesByName: make(map[string]*Info),
+		Runtimes:       make(map[string]*Info),
+	}
+
+	// archives are merged in a stable order so that the size of an entry
+	// always comes from the same image
+	var archiveNames []string
+	for archiveName := range archivesStats {
+		archiveNames = append(archiveNames, archiveName)
+	}
+	sort.Strings(archiveNames)
+
+	for _, archiveName := range archiveNames {
+		archiveStats := archivesStats[archiveName]
+		rollUpEntries(rollup.BaseOS, archiveStats.BaseOS, archiveName)
+		rollUpEntries(rollup.Packages, archiveStats.Packages, archiveName)
+		for _, runtimes := range archiveStats.Runtimes {
+			rollUpEntries(rollup.Runtimes, runtimes, archiveName)
+		}
+	}
+
+	rollUpPackagesByName(rollup)
+
+	return rollup
+}
+
+func rollUpPackagesByName(rollup *Rollup) {
+	var identities []string
+	for identity := range rollup.Packages {
+		identities = append(identities, identity)
+	}
+	sort.Strings(identities)
+
+	for _, identity := range identities {
+		info := rollup.Packages[identity]
+		name := PackageName(identity)
+
+		byName := rollup.PackagesByName[name]
+		if byName == nil {
+			byName = &Info{}
+			rollup.PackagesByName[name] = byName
+		}
+
+		// the largest build stands for the size of one copy
+		byName.CompressedSize = max(byName.CompressedSize, info.CompressedSize)
+		byName.UncompressedSize = max(byName.UncompressedSize, info.UncompressedSize)
+		byName.InstalledSize = max(byName.InstalledSize, info.InstalledSize)
+		byName.OnDiskSize = max(byName.OnDiskSize, info.OnDiskSize)
+		byName.Variants = append(byName.Variants, identity)
+		for _, image := range info.Images {
+			if !slices.Contains(byName.Images, image) {
+				byName.Images = append(byName.Images, image)
+			}
+		}
+		byName.Count = len(byName.Images)
+	}
+}
+
+func rollUpEntries(rollupEntries, archiveEntries map[string]*Info, archiveName string) {
+	for key, info := range archiveEntries {
+		rollupInfo := rollupEntries[key]
+		if rollupInfo == nil {
+			rollupInfo = &Info{
+				CompressedSize:   info.CompressedSize,
+				UncompressedSize: info.UncompressedSize,
+				InstalledSize:    info.InstalledSize,
+				OnDiskSize:       info.OnDiskSize,
+			}
+			rollupEntries[key] = rollupInfo
+		}
+
+		if len(rollupInfo.Images) == 0 || rollupInfo.Images[len(rollupInfo.Images)-1] != archiveName {
+			rollupInfo.Images = append(rollupInfo.Images, archiveName)
+			rollupInfo.Count++
+		}
+	}
+}
+
+// CopySize is the best known size of a single copy of the entry, the size
+// found on disk when known.
+func (info *Info) CopySize() int64 {
+	if info.OnDiskSize > 0 {
+		return info.OnDiskSize
+	}
+	return max(info.InstalledSize, info.UncompressedSize, info.CompressedSize)
+}
+
+// HasSizeDiscrepancy tells if the size declared by the package metadata is
+// far from the size of its files on disk, e.g. files removed after install.
+func (info *Info) HasSizeDiscrepancy() bool {
+	if info.InstalledSize == 0 || info.OnDiskSize == 0 {
+		return false
+	}
+
+	difference := info.InstalledSize - info.OnDiskSize
+	if difference < 0 {
+		difference = -difference
+	}
+	return difference >= sizeDiscrepancyMinBytes &&
+		(info.OnDiskSize*2 < info.InstalledSize || info.InstalledSize*2 < info.OnDiskSize)
+}
+
+// DuplicatedSize is the size of every copy but the first one.
+func (info *Info) DuplicatedSize() int64 {
+	if info.Count < 2 {
+		return 0
+	}
+	return int64(info.Count-1) * info.CopySize()
+}
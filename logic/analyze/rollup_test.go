@@ -0,0 +1,48 @@
+package analyze
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRollUpPackagesByName(t *testing.T) {
+	const (
+		libc12 = "pkg:deb/debian/libc6@2.36-9?distro=debian-12"
+		libc11 = "pkg:deb/debian/libc6@2.31-13?distro=debian-11"
+		guava  = "pkg:maven/com.google.guava/guava@32.1.2-jre"
+	)
+	archivesStats := map[string]*Stats{
+		"a.tar": {Packages: map[string]*Info{libc12: {OnDiskSize: 12_000_000}, guava: {OnDiskSize: 3_000_000}}},
+		"b.tar": {Packages: map[string]*Info{libc12: {OnDiskSize: 12_000_000}}},
+		"c.tar": {Packages: map[string]*Info{libc11: {OnDiskSize: 13_000_000}, guava: {OnDiskSize: 3_000_000}}},
+	}
+
+	rollup := RollUp(archivesStats)
+
+	// the same build in several images is one identity
+	if got := rollup.Packages[libc12]; got.Count != 2 || !reflect.DeepEqual(got.Images, []string{"a.tar", "b.tar"}) {
+		t.Errorf("Packages[%s] = %d in %v, want 2 in [a.tar b.tar]", libc12, got.Count, got.Images)
+	}
+
+	tests := []struct {
+		name         string
+		wantCount    int
+		wantSize     int64
+		wantVariants []string
+	}{
+		// the builds of a name are merged, the largest one is the size of a copy
+		{name: "libc6", wantCount: 3, wantSize: 13_000_000, wantVariants: []string{libc11, libc12}},
+		{name: "guava", wantCount: 2, wantSize: 3_000_000, wantVariants: []string{guava}},
+	}
+	for _, test := range tests {
+		got := rollup.PackagesByName[test.name]
+		if got == nil {
+			t.Errorf("PackagesByName[%s] is missing", test.name)
+			continue
+		}
+		if got.Count != test.wantCount || got.OnDiskSize != test.wantSize || !reflect.DeepEqual(got.Variants, test.wantVariants) {
+			t.Errorf("PackagesByName[%s] = count %d, size %d, variants %v, want %d, %d, %v",
+				test.name, got.Count, got.OnDiskSize, got.Variants, test.wantCount, test.wantSize, test.wantVariants)
+		}
+	}
+}
@@ -1,85 +1,203 @@
 package analyze
 
 import (
-	"fmt"
+	"bufio"
+	"encoding/base64"
+	"path"
 	"regexp"
-	"strconv"
+	"sort"
 	"strings"
 
-	"ova-size-optimizer/logic/load"
+	"github.com/anchore/syft/syft/pkg"
+	"github.com/anchore/syft/syft/sbom"
 )
 
-func DetectRuntime(packageProperties load.Metadata, runtimes map[string]map[string]*Info, fileName string) {
-	var runtime string
-	const (
-		javaInstallLocLib = "/usr/lib/jvm/.*/lib/"
-		javaInstallLocBin = "/usr/lib/jvm/.*/bin/"
-		pythonInstallBin  = "/usr/bin/python.*"
-	)
-
-	libReJava, err := regexp.Compile(javaInstallLocLib)
-	if err != nil {
-		fmt.Printf("Error compiling java regex: %v\n", err)
+// runtimeContentGlobs are the files whose content is needed to tell the
+// version of a runtime, they are cataloged with the SBOM.
+var runtimeContentGlobs = []string{"**/release", "**/go/VERSION", "**/go-*/VERSION", "**/include/node/node_version.h"}
+
+var (
+	javaReleaseRe   = regexp.MustCompile(`^(.+)/release$`)
+	pythonLibRe     = regexp.MustCompile(`^(.*)/lib/python(\d+\.\d+)/os\.py$`)
+	nodeBinaryRe    = regexp.MustCompile(`^(.*)/bin/node(?:js)?$`)
+	goVersionRe     = regexp.MustCompile(`^(.*/go(?:-[\d.]+)?)/VERSION$`)
+	dotnetCoreLibRe = regexp.MustCompile(`^(.*)/shared/Microsoft\.NETCore\.App/([^/]+)/System\.Private\.CoreLib\.dll$`)
+	rubyLibRe       = regexp.MustCompile(`^(.*)/lib/ruby/(\d+\.\d+\.\d+)/rubygems\.rb$`)
+	nodeVersionRe   = regexp.MustCompile(`#define NODE_(MAJOR|MINOR|PATCH)_VERSION (\d+)`)
+)
+
+// Runtime is a language runtime installed in an image.
+type Runtime struct {
+	Name    string
+	Vendor  string
+	Version string
+	Path    string
+	Size    int64
+}
+
+// Key identifies the same build of a runtime across images.
+func (runtime Runtime) Key() string {
+	return strings.TrimSpace(runtime.Vendor + " " + runtime.Name + " " + runtime.Version)
+}
+
+// DetectRuntimes finds the JDK/JRE, CPython, Node.js, Go, .NET and Ruby
+// installations of an image from its file catalog. Versions come from the
+// runtime files, or from the binaries recognized by syft.
+func DetectRuntimes(archiveSbom *sbom.SBOM, files *fileIndex) []Runtime {
+	contents := fileContents(archiveSbom)
+
+	var runtimes []Runtime
+	for _, filePath := range files.paths {
+		if matches := javaReleaseRe.FindStringSubmatch(filePath); matches != nil {
+			if runtime, ok := detectJava(matches[1], contents[filePath], files); ok {
+				runtimes = append(runtimes, runtime)
+			}
+		} else if matches := pythonLibRe.FindStringSubmatch(filePath); matches != nil {
+			runtimes = append(runtimes, detectPython(matches[1], matches[2], archiveSbom, files))
+		} else if matches := nodeBinaryRe.FindStringSubmatch(filePath); matches != nil {
+			runtimes = append(runtimes, detectNode(matches[1], filePath, archiveSbom, contents, files))
+		} else if matches := goVersionRe.FindStringSubmatch(filePath); matches != nil {
+			if runtime, ok := detectGo(matches[1], contents[filePath], files); ok {
+				runtimes = append(runtimes, runtime)
+			}
+		} else if matches := dotnetCoreLibRe.FindStringSubmatch(filePath); matches != nil {
+			frameworkDir := path.Dir(filePath)
+			runtimes = append(runtimes, Runtime{Name: ".NET", Version: matches[2], Path: frameworkDir, Size: files.treeSize(frameworkDir)})
+		} else if matches := rubyLibRe.FindStringSubmatch(filePath); matches != nil {
+			runtimes = append(runtimes, detectRuby(matches[1], matches[2], archiveSbom, files))
+		}
 	}
 
-	binReJava, err := regexp.Compile(javaInstallLocBin)
-	if err != nil {
-		fmt.Printf("Error compiling java regex: %v\n", err)
+	// a node binary only reachable through a symlink, e.g. /usr/local/bin/node
+	// to /opt/nodejs/node, isn't found with the regular files
+	var links []string
+	for link := range files.symlinks {
+		links = append(links, link)
 	}
+	sort.Strings(links)
+	for _, link := range links {
+		matches := nodeBinaryRe.FindStringSubmatch(link)
+		if matches == nil {
+			continue
+		}
+		binary := files.followSymlinks(link)
+		if _, ok := files.fileSize(binary); ok && !nodeBinaryRe.MatchString(binary) {
+			runtimes = append(runtimes, detectNode(matches[1], binary, archiveSbom, contents, files))
+		}
+	}
+	return runtimes
+}
 
-	binRePython, err := regexp.Compile(pythonInstallBin)
-	if err != nil {
-		fmt.Printf("Error compiling python regex: %v\n", err)
+func fileContents(archiveSbom *sbom.SBOM) map[string]string {
+	contents := map[string]string{}
+	for coordinates, encoded := range archiveSbom.Artifacts.FileContents {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		contents[coordinates.RealPath] = string(decoded)
 	}
+	return contents
+}
 
-	for _, v := range packageProperties.Files {
-		if libReJava.MatchString(v.Path) ||
-			binReJava.MatchString(v.Path) ||
-			binRePython.MatchString(v.Path) {
-			// we want to store as a runtime the distribution of java or python or etc
-			// eg. /usr/lib/jvm/zulu-openjdk-5.3/lib/ => [3] is zulu-openjdk-5.3
-			// if multiple runtimes are on the same container/image we will have that in the map
-			runtimeSlc := strings.FieldsFunc(v.Path, func(c rune) bool {
-				return c == '/'
-			})
-
-			for _, elem := range runtimeSlc {
-				if strings.Contains(elem, "jdk") ||
-					strings.Contains(elem, "jre") ||
-					strings.Contains(elem, "python") ||
-					strings.Contains(elem, "rust") ||
-					strings.Contains(elem, "golang") {
-					runtime = elem
-				}
+// binaryVersion returns the version of the binary syft recognized as
+// packageName below dir.
+func binaryVersion(archiveSbom *sbom.SBOM, packageName, dir string) string {
+	for _, binaryPackage := range archiveSbom.Artifacts.Packages.PackagesByName(packageName) {
+		if _, ok := binaryPackage.Metadata.(pkg.BinarySignature); !ok {
+			continue
+		}
+		for _, location := range binaryPackage.Locations.ToSlice() {
+			if strings.HasPrefix(location.RealPath, dir+"/") {
+				return binaryPackage.Version
 			}
+		}
+	}
+	return ""
+}
+
+// detectJava reads the release file at the root of every JDK and JRE, e.g.
+// JAVA_VERSION="17.0.9" and IMPLEMENTOR="Eclipse Adoptium".
+func detectJava(javaHome, release string, files *fileIndex) (Runtime, bool) {
+	if _, ok := files.fileSize(files.resolve(javaHome + "/bin/java")); !ok {
+		return Runtime{}, false
+	}
+
+	runtime := Runtime{Name: "JRE", Path: javaHome, Size: files.treeSize(javaHome)}
+	if _, ok := files.fileSize(files.resolve(javaHome + "/bin/javac")); ok {
+		runtime.Name = "JDK"
+	}
 
-			if runtimes[fileName][runtime] == nil {
-				// new runtime
-				// store the count of appearence and add the size
-				runtimes[fileName][runtime] = &Info{
-					Count: 1,
-					Size:  strconv.FormatInt(int64(v.Size), 10),
-				}
-			} else {
-				sizeInt64, err := strconv.ParseInt(runtimes[fileName][runtime].Size, 10, 64)
-				if err != nil {
-					fmt.Println("Failed to convert string to int")
-					return
-				}
-				runtimes[fileName][runtime].Size = strconv.FormatInt(sizeInt64+int64(v.Size), 10)
+	scanner := bufio.NewScanner(strings.NewReader(release))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found {
+			continue
+		}
+		value = strings.Trim(value, `"`)
+		switch key {
+		case "JAVA_VERSION":
+			runtime.Version = value
+		case "IMPLEMENTOR":
+			runtime.Vendor = value
+		}
+	}
+	return runtime, true
+}
+
+func detectPython(prefix, libVersion string, archiveSbom *sbom.SBOM, files *fileIndex) Runtime {
+	libDir := prefix + "/lib/python" + libVersion
+	runtime := Runtime{Name: "CPython", Version: libVersion, Path: libDir}
+	if version := binaryVersion(archiveSbom, "python", prefix); version != "" {
+		runtime.Version = version
+	}
+
+	// packages installed with pip are language packages of their own
+	runtime.Size = files.treeSize(libDir) - files.treeSize(libDir+"/site-packages") - files.treeSize(libDir+"/dist-packages")
+	for _, dir := range []string{prefix + "/bin", prefix + "/lib"} {
+		for _, filePath := range files.treeFiles(dir, "") {
+			name := path.Base(filePath)
+			if path.Dir(filePath) == dir && (strings.HasPrefix(name, "python"+libVersion) || strings.HasPrefix(name, "libpython"+libVersion)) {
+				runtime.Size += files.sizes[filePath]
 			}
 		}
 	}
+	return runtime
+}
+
+func detectNode(prefix, binary string, archiveSbom *sbom.SBOM, contents map[string]string, files *fileIndex) Runtime {
+	version := binaryVersion(archiveSbom, "node", path.Dir(binary))
+	if version == "" {
+		parts := map[string]string{}
+		for _, matches := range nodeVersionRe.FindAllStringSubmatch(contents[prefix+"/include/node/node_version.h"], -1) {
+			parts[matches[1]] = matches[2]
+		}
+		if len(parts) == 3 {
+			version = parts["MAJOR"] + "." + parts["MINOR"] + "." + parts["PATCH"]
+		}
+	}
 
+	size, _ := files.fileSize(binary)
+	return Runtime{Name: "Node.js", Version: version, Path: prefix, Size: size + files.treeSize(prefix+"/include/node")}
 }
 
-// runtime := ""
-// if strings.Contains(pkgURL, "pkg:generic/java/") || strings.Contains(pkgURL, "pkg:maven/") {
-// 	if strings.Contains(pkgURL, "jre") || strings.Contains(pkgURL, "jdk") {
-// 		runtime = "Java"
-// 	}
-// } else if strings.Contains(pkgURL, "pkg:python/") {
-// 	if strings.Contains(pkgURL, "cpython") {
-// 		runtime = "Python"
-// 	}
-// }
+// detectGo reads the VERSION file at the root of a Go toolchain, e.g.
+// go1.22.1 followed by the build time.
+func detectGo(goRoot, versionFile string, files *fileIndex) (Runtime, bool) {
+	if _, ok := files.fileSize(goRoot + "/bin/go"); !ok {
+		return Runtime{}, false
+	}
+
+	version, _, _ := strings.Cut(versionFile, "\n")
+	return Runtime{Name: "Go", Version: strings.TrimPrefix(strings.TrimSpace(version), "go"), Path: goRoot, Size: files.treeSize(goRoot)}, true
+}
+
+func detectRuby(prefix, version string, archiveSbom *sbom.SBOM, files *fileIndex) Runtime {
+	libDir := prefix + "/lib/ruby/" + version
+	if binaryVersion := binaryVersion(archiveSbom, "ruby", prefix); binaryVersion != "" {
+		version = binaryVersion
+	}
+
+	size, _ := files.fileSize(prefix + "/bin/ruby")
+	return Runtime{Name: "Ruby", Version: version, Path: libDir, Size: size + files.treeSize(libDir)}
+}
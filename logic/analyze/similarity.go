@@ -0,0 +1,247 @@
+package analyze
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	// minHashSize is the number of hash functions of a MinHash signature, it
+	// is split in lshBands bands to find the candidate pairs
+	minHashSize = 128
+	lshBands    = 32
+	lshRows     = minHashSize / lshBands
+	// nearDuplicateMinSimilarity is the share of their bytes two layers need
+	// in identical files to be near duplicates
+	nearDuplicateMinSimilarity = 0.8
+)
+
+// NearDuplicateCluster is layers mostly made of the same files, e.g. the
+// same application with one changed jar.
+type NearDuplicateCluster struct {
+	Layers []*SharedLayer
+	// CommonSize is the size of the files identical in all the layers
+	CommonSize int64
+	// DifferingFiles are the files of every layer that aren't common to all
+	// the layers, by diffID
+	DifferingFiles map[string][]LayerFile
+	// Savings is what moving the common files to a layer of their own, shared
+	// by the images, would save
+	Savings int64
+}
+
+// fileListCollector lists the regular files of a layer, whiteouts aren't
+// files of the image.
+type fileListCollector struct {
+	files []LayerFile
+}
+
+func (collector *fileListCollector) contentWriter(*tar.Header, string) io.Writer {
+	return nil
+}
+
+func (collector *fileListCollector) add(entry layerEntry) {
+	if entry.Header.Typeflag != tar.TypeReg || strings.HasPrefix(path.Base(entry.Path), whiteoutPrefix) {
+		return
+	}
+	collector.files = append(collector.files, LayerFile{Path: entry.Path, Digest: entry.Digest, Size: entry.Header.Size})
+}
+
+func (collector *fileListCollector) finish(fingerprint *LayerFingerprint) {
+	sort.Slice(collector.files, func(i, j int) bool {
+		return collector.files[i].Path < collector.files[j].Path
+	})
+	fingerprint.Files = collector.files
+}
+
+// DetectNearDuplicateLayers estimates the similarity of the files of all
+// layers with MinHash, finds the candidate pairs with locality-sensitive
+// hashing and checks them on the bytes of their identical files. Layers with
+// the exact same files are left to DetectNonReproducibleLayers.
+func DetectNearDuplicateLayers(sharing LayerSharing) []NearDuplicateCluster {
+	var layers []*SharedLayer
+	for _, layer := range distinctLayers(sharing) {
+		if len(layer.Fingerprint.Files) > 0 {
+			layers = append(layers, layer)
+		}
+	}
+
+	type bandKey struct {
+		band int
+		rows [lshRows]uint64
+	}
+	buckets := map[bandKey][]int{}
+	for i, layer := range layers {
+		signature := minHashSignature(layer.Fingerprint.Files)
+		for band := 0; band < lshBands; band++ {
+			key := bandKey{band: band}
+			copy(key.rows[:], signature[band*lshRows:(band+1)*lshRows])
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	// union-find of the layers confirmed similar
+	parents := make([]int, len(layers))
+	for i := range parents {
+		parents[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+		return parents[i]
+	}
+
+	checked := map[[2]int]bool{}
+	for _, bucket := range buckets {
+		for i := 0; i < len(bucket); i++ {
+			for j := i + 1; j < len(bucket); j++ {
+				pair := [2]int{bucket[i], bucket[j]}
+				if checked[pair] {
+					continue
+				}
+				checked[pair] = true
+
+				layer, otherLayer := layers[pair[0]], layers[pair[1]]
+				if layer.Fingerprint.ContentDigest == otherLayer.Fingerprint.ContentDigest {
+					continue
+				}
+				if fileSimilarity(layer.Fingerprint.Files, otherLayer.Fingerprint.Files) >= nearDuplicateMinSimilarity {
+					parents[find(pair[0])] = find(pair[1])
+				}
+			}
+		}
+	}
+
+	clusterLayers := map[int][]*SharedLayer{}
+	for i, layer := range layers {
+		root := find(i)
+		clusterLayers[root] = append(clusterLayers[root], layer)
+	}
+
+	var clusters []NearDuplicateCluster
+	for _, members := range clusterLayers {
+		if len(members) < 2 {
+			continue
+		}
+
+		commonFiles := members[0].Fingerprint.Files
+		for _, member := range members[1:] {
+			commonFiles = intersectFiles(commonFiles, member.Fingerprint.Files)
+		}
+		cluster := NearDuplicateCluster{Layers: members, DifferingFiles: map[string][]LayerFile{}}
+		for _, file := range commonFiles {
+			cluster.CommonSize += file.Size
+		}
+		// layers only similar through a chain of others can have no file in
+		// common, there is nothing to move to a shared layer then
+		if cluster.CommonSize == 0 {
+			continue
+		}
+		for _, member := range members {
+			cluster.DifferingFiles[member.DiffID] = subtractFiles(member.Fingerprint.Files, commonFiles)
+		}
+		cluster.Savings = int64(len(members)-1) * cluster.CommonSize
+		clusters = append(clusters, cluster)
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Savings != clusters[j].Savings {
+			return clusters[i].Savings > clusters[j].Savings
+		}
+		return clusters[i].Layers[0].DiffID < clusters[j].Layers[0].DiffID
+	})
+	return clusters
+}
+
+// minHashSignature hashes every file, path and content together, with
+// minHashSize hash functions and keeps the minimum of each.
+func minHashSignature(files []LayerFile) [minHashSize]uint64 {
+	var signature [minHashSize]uint64
+	for i := range signature {
+		signature[i] = math.MaxUint64
+	}
+
+	for _, file := range files {
+		hash := fnv.New64a()
+		hash.Write([]byte(file.Path))
+		element := hash.Sum64() ^ binary.BigEndian.Uint64(file.Digest[:8])
+		for i := range signature {
+			signature[i] = min(signature[i], mix64(element^uint64(i+1)*0x9e3779b97f4a7c15))
+		}
+	}
+	return signature
+}
+
+// mix64 is the splitmix64 finalizer, a cheap hash of a 64-bit value.
+func mix64(value uint64) uint64 {
+	value = (value ^ (value >> 30)) * 0xbf58476d1ce4e5b9
+	value = (value ^ (value >> 27)) * 0x94d049bb133111eb
+	return value ^ (value >> 31)
+}
+
+// fileSimilarity is the size of the files identical in both layers over the
+// size of the files of either layer.
+func fileSimilarity(files, otherFiles []LayerFile) float64 {
+	var commonSize, totalSize int64
+	for _, file := range intersectFiles(files, otherFiles) {
+		commonSize += file.Size
+	}
+	for _, file := range files {
+		totalSize += file.Size
+	}
+	for _, file := range otherFiles {
+		totalSize += file.Size
+	}
+
+	unionSize := totalSize - commonSize
+	if unionSize == 0 {
+		return 1
+	}
+	return float64(commonSize) / float64(unionSize)
+}
+
+// intersectFiles keeps the files of both sorted lists with the same path and
+// content.
+func intersectFiles(files, otherFiles []LayerFile) []LayerFile {
+	var common []LayerFile
+	for i, j := 0, 0; i < len(files) && j < len(otherFiles); {
+		switch {
+		case files[i].Path < otherFiles[j].Path:
+			i++
+		case files[i].Path > otherFiles[j].Path:
+			j++
+		default:
+			if files[i].Digest == otherFiles[j].Digest {
+				common = append(common, files[i])
+			}
+			i++
+			j++
+		}
+	}
+	return common
+}
+
+// subtractFiles keeps the files of the sorted list that aren't in the sorted
+// excluded ones.
+func subtractFiles(files, excludedFiles []LayerFile) []LayerFile {
+	var remaining []LayerFile
+	j := 0
+	for _, file := range files {
+		for j < len(excludedFiles) && excludedFiles[j].Path < file.Path {
+			j++
+		}
+		if j < len(excludedFiles) && excludedFiles[j].Path == file.Path && excludedFiles[j].Digest == file.Digest {
+			continue
+		}
+		remaining = append(remaining, file)
+	}
+	return remaining
+}
@@ -0,0 +1,101 @@
+package analyze
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// testLayer is a layer of files of 100 bytes, the version of a file is its
+// content.
+func testLayer(diffID string, versions []int) *SharedLayer {
+	fingerprint := &LayerFingerprint{ContentDigest: fmt.Sprint(versions)}
+	for i, version := range versions {
+		filePath := fmt.Sprintf("app/file%02d", i)
+		fingerprint.Files = append(fingerprint.Files, LayerFile{Path: filePath, Size: 100,
+			Digest: sha256.Sum256([]byte(fmt.Sprintf("%s %d", filePath, version)))})
+	}
+	return &SharedLayer{Digest: diffID, DiffID: diffID, Images: []string{diffID + ".tar"}, Fingerprint: fingerprint}
+}
+
+func TestDetectNearDuplicateLayers(t *testing.T) {
+	// chain returns layers of 10 files each changing one more file of the
+	// previous one, consecutive layers have 9 files of 11 in common
+	chain := func(prefix string, length int) []*SharedLayer {
+		var layers []*SharedLayer
+		versions := make([]int, 10)
+		for i := 0; i < length; i++ {
+			if i > 0 {
+				versions[i-1] = i
+			}
+			layers = append(layers, testLayer(fmt.Sprintf("sha256:%s%d", prefix, i), slices.Clone(versions)))
+		}
+		return layers
+	}
+
+	tests := []struct {
+		name   string
+		layers []*SharedLayer
+		// want are the diffIDs of every cluster with its common size
+		want       [][]string
+		wantCommon []int64
+	}{
+		{
+			name:       "one file differs",
+			layers:     chain("a", 2),
+			want:       [][]string{{"sha256:a0", "sha256:a1"}},
+			wantCommon: []int64{900},
+		},
+		{
+			// left to DetectNonReproducibleLayers
+			name: "identical files",
+			layers: []*SharedLayer{
+				testLayer("sha256:a", []int{0, 0, 0, 0, 0}),
+				testLayer("sha256:b", []int{0, 0, 0, 0, 0}),
+			},
+		},
+		{
+			name: "half the files differ",
+			layers: []*SharedLayer{
+				testLayer("sha256:a", []int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0}),
+				testLayer("sha256:b", []int{0, 0, 0, 0, 0, 1, 1, 1, 1, 1}),
+			},
+		},
+		{
+			// the first and last layers are only similar through the others
+			name:       "transitive chain",
+			layers:     chain("a", 4),
+			want:       [][]string{{"sha256:a0", "sha256:a1", "sha256:a2", "sha256:a3"}},
+			wantCommon: []int64{700},
+		},
+		{
+			// every file is changed along the chain, no file is common
+			name:   "transitive chain without common files",
+			layers: chain("a", 11),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clusters := DetectNearDuplicateLayers(LayerSharing{Layers: test.layers})
+			var got [][]string
+			var gotCommon []int64
+			for _, cluster := range clusters {
+				var diffIDs []string
+				for _, layer := range cluster.Layers {
+					diffIDs = append(diffIDs, layer.DiffID)
+				}
+				slices.Sort(diffIDs)
+				got = append(got, diffIDs)
+				gotCommon = append(gotCommon, cluster.CommonSize)
+
+				if want := int64(len(cluster.Layers)-1) * cluster.CommonSize; cluster.Savings != want {
+					t.Errorf("DetectNearDuplicateLayers() savings = %d, want %d", cluster.Savings, want)
+				}
+			}
+			if !slices.EqualFunc(got, test.want, slices.Equal) || !slices.Equal(gotCommon, test.wantCommon) {
+				t.Errorf("DetectNearDuplicateLayers() = %v with %v common, want %v with %v common", got, gotCommon, test.want, test.wantCommon)
+			}
+		})
+	}
+}
@@ -10,7 +10,7 @@ func DebugMapPrint(entries map[string]*Info) {
 	fmt.Println(strings.Repeat("-", 40))
 
 	for key, info := range entries {
-		fmt.Printf("%-30s\t%d %s\t%s \n", key, info.Count, info.Size, info.InstalledSize)
+		fmt.Printf("%-30s\t%d %d\t%d\t%d \n", key, info.Count, info.CompressedSize, info.UncompressedSize, info.InstalledSize)
 	}
 }
 
@@ -21,7 +21,7 @@ func DebugRuntimeMapPrint(entries map[string]map[string]*Info) {
 	for outerKey, innerMap := range entries {
 		fmt.Printf("%-30s\n", outerKey)
 		for innerKey, value := range innerMap {
-			fmt.Printf("\t%-30s: %s", innerKey, fmt.Sprintf("%d %s\t%s \n", value.Count, value.Size, value.InstalledSize))
+			fmt.Printf("\t%-30s: %s", innerKey, fmt.Sprintf("%d %d\t%d\t%d \n", value.Count, value.CompressedSize, value.UncompressedSize, value.InstalledSize))
 		}
 		fmt.Println(strings.Repeat("-", 40)) // Separator for each outer key
 	}
@@ -45,31 +45,17 @@ func GetOnlyDuplicatesRuntimes(entries map[string]map[string]*Info) map[string]*
 		}
 	}
 
+	// the entries are copied so that the per image counts stay untouched
 	duplicates := make(map[string]*Info)
 	for _, infoMap := range entries {
 		for key, info := range infoMap {
-			if globalCounts[key] >= 2 {
-				info.Count = globalCounts[key]
-				duplicates[key] = info
+			if globalCounts[key] >= 2 && duplicates[key] == nil {
+				duplicate := *info
+				duplicate.Count = globalCounts[key]
+				duplicates[key] = &duplicate
 			}
 		}
 	}
 
 	return duplicates
 }
-
-func ConvertSizeBytesToHumanReadableString(sizeBytes int64) string {
-	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
-
-	if sizeBytes == 0 {
-		return "0B"
-	}
-	size := float64(sizeBytes)
-	i := 0
-	for size >= 1024 && i < len(units)-1 {
-		size /= 1024 // Divide size by 1024 to convert to the next higher unit
-		i++
-	}
-
-	return fmt.Sprintf("%.2f%s", size, units[i])
-}
@@ -0,0 +1,198 @@
+package analyze
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Whiteout files delete a path of the layers below, see the OCI layer spec.
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// WastedFile is a file of a layer that a later layer of the image deletes or
+// overwrites, the bundle still ships it. Layers are numbered from 0, the
+// steps that created them come from the image history.
+type WastedFile struct {
+	Path        string
+	Size        int64
+	AddedIn     int
+	AddedBy     string
+	RemovedIn   int
+	RemovedBy   string
+	Overwritten bool
+}
+
+// ImageWaste is the files of an image that aren't visible in the image
+// anymore but are stored in its layers.
+type ImageWaste struct {
+	Image string
+	// TotalSize is the size of the files of all the layers
+	TotalSize  int64
+	WastedSize int64
+	// Files are sorted by size, the largest first
+	Files []WastedFile
+}
+
+// Efficiency is the share of the bytes of the layers visible in the image,
+// like the efficiency score of dive.
+func (waste ImageWaste) Efficiency() float64 {
+	if waste.TotalSize == 0 {
+		return 1
+	}
+	return float64(waste.TotalSize-waste.WastedSize) / float64(waste.TotalSize)
+}
+
+// wasteCollector lists the paths a layer deletes, the directories it
+// empties and its entries other than regular files.
+type wasteCollector struct {
+	whiteouts, opaqueDirs, dirs, links []string
+}
+
+func (collector *wasteCollector) contentWriter(*tar.Header, string) io.Writer {
+	return nil
+}
+
+func (collector *wasteCollector) add(entry layerEntry) {
+	dir, name := path.Split(entry.Path)
+	switch {
+	case name == opaqueWhiteout:
+		collector.opaqueDirs = append(collector.opaqueDirs, strings.TrimSuffix(dir, "/"))
+	case strings.HasPrefix(name, whiteoutPrefix):
+		collector.whiteouts = append(collector.whiteouts, dir+strings.TrimPrefix(name, whiteoutPrefix))
+	case entry.Path == "":
+		// the root directory of the layer
+	case entry.Header.Typeflag == tar.TypeDir:
+		collector.dirs = append(collector.dirs, entry.Path)
+	case entry.Header.Typeflag != tar.TypeReg:
+		collector.links = append(collector.links, entry.Path)
+	}
+}
+
+func (collector *wasteCollector) finish(fingerprint *LayerFingerprint) {
+	fingerprint.Whiteouts = collector.whiteouts
+	fingerprint.OpaqueDirs = collector.opaqueDirs
+	fingerprint.Dirs = collector.dirs
+	fingerprint.Links = collector.links
+}
+
+// DetectLayerWaste applies the layers of every image in order, with their
+// whiteouts and opaque directories, and collects the files deleted or
+// overwritten by a later layer. The most wasteful images come first.
+func DetectLayerWaste(archivesStats map[string]*Stats) []ImageWaste {
+	var wastes []ImageWaste
+	for archiveName, stats := range archivesStats {
+		if len(stats.Layers) == 0 {
+			continue
+		}
+
+		waste := ImageWaste{Image: archiveName}
+		// the layer that added every file visible so far, and its size
+		type visibleFile struct {
+			layer int
+			size  int64
+		}
+		visible := map[string]visibleFile{}
+		// the visible files below every directory, the root directory is ""
+		filesBelow := map[string]map[string]bool{}
+		parentDirs := func(filePath string) []string {
+			dirs := []string{""}
+			for i := range filePath {
+				if filePath[i] == '/' {
+					dirs = append(dirs, filePath[:i])
+				}
+			}
+			return dirs
+		}
+		add := func(filePath string, layer int, size int64) {
+			visible[filePath] = visibleFile{layer: layer, size: size}
+			for _, dir := range parentDirs(filePath) {
+				if filesBelow[dir] == nil {
+					filesBelow[dir] = map[string]bool{}
+				}
+				filesBelow[dir][filePath] = true
+			}
+		}
+		remove := func(filePath string, layer int, overwritten bool) {
+			file := visible[filePath]
+			waste.Files = append(waste.Files, WastedFile{
+				Path:        filePath,
+				Size:        file.size,
+				AddedIn:     file.layer,
+				AddedBy:     stats.Layers[file.layer].CreatedBy,
+				RemovedIn:   layer,
+				RemovedBy:   stats.Layers[layer].CreatedBy,
+				Overwritten: overwritten,
+			})
+			waste.WastedSize += file.size
+			delete(visible, filePath)
+			for _, dir := range parentDirs(filePath) {
+				delete(filesBelow[dir], filePath)
+			}
+		}
+		removeDir := func(dir string, layer int, overwritten bool) {
+			for filePath := range filesBelow[dir] {
+				remove(filePath, layer, overwritten)
+			}
+		}
+		// replace removes the file at a path, or the files of the directory
+		// at that path unless a directory replaces it, they are merged then
+		replace := func(entryPath string, layer int, isDir bool) {
+			if _, ok := visible[entryPath]; ok {
+				remove(entryPath, layer, true)
+			} else if !isDir {
+				removeDir(entryPath, layer, true)
+			}
+		}
+
+		for i, layer := range stats.Layers {
+			if layer.Fingerprint == nil {
+				continue
+			}
+
+			// whiteouts only apply to the layers below
+			for _, dir := range layer.Fingerprint.OpaqueDirs {
+				removeDir(dir, i, false)
+			}
+			for _, whiteout := range layer.Fingerprint.Whiteouts {
+				if _, ok := visible[whiteout]; ok {
+					remove(whiteout, i, false)
+				} else {
+					removeDir(whiteout, i, false)
+				}
+			}
+
+			for _, dir := range layer.Fingerprint.Dirs {
+				replace(dir, i, true)
+			}
+			for _, link := range layer.Fingerprint.Links {
+				replace(link, i, false)
+			}
+			for _, file := range layer.Fingerprint.Files {
+				replace(file.Path, i, false)
+				add(file.Path, i, file.Size)
+				waste.TotalSize += file.Size
+			}
+		}
+
+		sort.Slice(waste.Files, func(i, j int) bool {
+			if waste.Files[i].Size != waste.Files[j].Size {
+				return waste.Files[i].Size > waste.Files[j].Size
+			}
+			return waste.Files[i].Path < waste.Files[j].Path
+		})
+		wastes = append(wastes, waste)
+	}
+
+	sort.Slice(wastes, func(i, j int) bool {
+		if wastes[i].WastedSize != wastes[j].WastedSize {
+			return wastes[i].WastedSize > wastes[j].WastedSize
+		}
+		return wastes[i].Image < wastes[j].Image
+	})
+	return wastes
+}
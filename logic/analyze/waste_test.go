@@ -0,0 +1,94 @@
+package analyze
+
+import (
+	"archive/tar"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDetectLayerWaste(t *testing.T) {
+	base := []testTarEntry{
+		{name: "app/", typeflag: tar.TypeDir},
+		{name: "app/bin", content: strings.Repeat("b", 100)},
+		{name: "app/lib/libapp.so", content: strings.Repeat("l", 50)},
+		{name: "etc/config", content: strings.Repeat("c", 10)},
+		{name: "cache/data", content: strings.Repeat("d", 30)},
+	}
+
+	tests := []struct {
+		name string
+		// layers are applied on top of base
+		layers [][]testTarEntry
+		// want are the wasted paths, with "!" when they are overwritten
+		want []string
+	}{
+		{name: "no change", layers: [][]testTarEntry{{{name: "app/new", content: "new"}}}, want: nil},
+		{name: "whiteout file", layers: [][]testTarEntry{{{name: "etc/.wh.config"}}}, want: []string{"etc/config"}},
+		{name: "whiteout directory", layers: [][]testTarEntry{{{name: "app/.wh.lib"}}}, want: []string{"app/lib/libapp.so"}},
+		{name: "opaque directory", layers: [][]testTarEntry{{
+			{name: "app/.wh..wh..opq"},
+			{name: "app/bin", content: "new"},
+		}}, want: []string{"app/bin", "app/lib/libapp.so"}},
+		{name: "opaque root", layers: [][]testTarEntry{{{name: ".wh..wh..opq"}}},
+			want: []string{"app/bin", "app/lib/libapp.so", "cache/data", "etc/config"}},
+		{name: "overwritten file", layers: [][]testTarEntry{{{name: "app/bin", content: "new"}}}, want: []string{"!app/bin"}},
+		{name: "overwritten by a symlink", layers: [][]testTarEntry{{
+			{name: "etc/config", typeflag: tar.TypeSymlink, linkname: "/run/config"},
+		}}, want: []string{"!etc/config"}},
+		{name: "overwritten by a hardlink", layers: [][]testTarEntry{{
+			{name: "app/new", content: "new"},
+			{name: "etc/config", typeflag: tar.TypeLink, linkname: "app/new"},
+		}}, want: []string{"!etc/config"}},
+		{name: "overwritten by a directory", layers: [][]testTarEntry{{
+			{name: "etc/config/", typeflag: tar.TypeDir},
+			{name: "etc/config/main", content: "main"},
+		}}, want: []string{"!etc/config"}},
+		{name: "directory replaced by a symlink", layers: [][]testTarEntry{{
+			{name: "cache", typeflag: tar.TypeSymlink, linkname: "/tmp"},
+		}}, want: []string{"!cache/data"}},
+		{name: "directory merged", layers: [][]testTarEntry{{
+			{name: "app/", typeflag: tar.TypeDir},
+			{name: "app/lib/", typeflag: tar.TypeDir},
+		}}, want: nil},
+		{name: "removed then added again", layers: [][]testTarEntry{
+			{{name: "etc/.wh.config"}},
+			{{name: "etc/config", content: "again"}},
+			{{name: "etc/config", content: "later"}},
+		}, want: []string{"!etc/config", "etc/config"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stats := &Stats{}
+			for _, entries := range append([][]testTarEntry{base}, test.layers...) {
+				fingerprint, err := fingerprintLayer(makeTestTar(t, entries))
+				if err != nil {
+					t.Fatal(err)
+				}
+				stats.Layers = append(stats.Layers, Layer{Fingerprint: fingerprint})
+			}
+
+			wastes := DetectLayerWaste(map[string]*Stats{"app.tar": stats})
+			if len(wastes) != 1 {
+				t.Fatalf("DetectLayerWaste() = %d images, want 1", len(wastes))
+			}
+			var got []string
+			var wastedSize int64
+			for _, file := range wastes[0].Files {
+				if file.Overwritten {
+					got = append(got, "!"+file.Path)
+				} else {
+					got = append(got, file.Path)
+				}
+				wastedSize += file.Size
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("DetectLayerWaste() wasted files = %v, want %v", got, test.want)
+			}
+			if wastes[0].WastedSize != wastedSize {
+				t.Errorf("DetectLayerWaste() wasted size = %d, want the %d of its files", wastes[0].WastedSize, wastedSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package disk
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Entry is a file stored in an appliance bundle. OVA tars are never
+// compressed, so every entry can be read in place through a section of the
+// tar file.
+type Entry struct {
+	Name   string
+	Offset int64
+	Size   int64
+
+	file *os.File
+}
+
+// Bundle is an appliance as shipped: an OVA (or any uncompressed tar) or a
+// directory holding the disk images, e.g. the qcow2 files of the KVM flavour.
+type Bundle struct {
+	Path    string
+	Entries []Entry
+
+	files []*os.File
+}
+
+var diskExtensions = []string{".vmdk", ".qcow2", ".raw", ".img"}
+
+func OpenBundle(bundlePath string) (*Bundle, error) {
+	info, err := os.Stat(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening bundle %s: %w", bundlePath, err)
+	}
+
+	bundle := &Bundle{Path: bundlePath}
+	if info.IsDir() {
+		err = bundle.readDir()
+	} else {
+		err = bundle.readTar()
+	}
+	if err != nil {
+		bundle.Close()
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
+func (b *Bundle) readDir() error {
+	dirEntries, err := os.ReadDir(b.Path)
+	if err != nil {
+		return fmt.Errorf("error reading bundle directory %s: %w", b.Path, err)
+	}
+
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.Type().IsRegular() {
+			continue
+		}
+
+		file, err := os.Open(filepath.Join(b.Path, dirEntry.Name()))
+		if err != nil {
+			return fmt.Errorf("error opening bundle file %s: %w", dirEntry.Name(), err)
+		}
+		b.files = append(b.files, file)
+
+		info, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("error reading bundle file %s: %w", dirEntry.Name(), err)
+		}
+		b.Entries = append(b.Entries, Entry{Name: dirEntry.Name(), Size: info.Size(), file: file})
+	}
+
+	return nil
+}
+
+func (b *Bundle) readTar() error {
+	file, err := os.Open(b.Path)
+	if err != nil {
+		return fmt.Errorf("error opening bundle %s: %w", b.Path, err)
+	}
+	b.files = append(b.files, file)
+
+	tarReader := tar.NewReader(file)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading bundle entry: %w", err)
+		}
+
+		// tar.Reader consumes exactly the header blocks, so the current
+		// position of the underlying file is the start of the entry data
+		offset, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("error locating bundle entry %s: %w", header.Name, err)
+		}
+
+		if header.Typeflag == tar.TypeReg {
+			b.Entries = append(b.Entries, Entry{Name: header.Name, Offset: offset, Size: header.Size, file: file})
+		}
+	}
+}
+
+func (b *Bundle) Close() error {
+	var firstErr error
+	for _, file := range b.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (b *Bundle) Open(entry Entry) *io.SectionReader {
+	return io.NewSectionReader(entry.file, entry.Offset, entry.Size)
+}
+
+func (b *Bundle) Entry(name string) (Entry, bool) {
+	for _, entry := range b.Entries {
+		if path.Clean(entry.Name) == path.Clean(name) {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// backingEntry finds the qcow2 backing file of an entry. A relative name is
+// relative to the directory of the entry, as qemu resolves it. An absolute
+// one points to the host the image was built on, it is matched on its base
+// name when no other entry has the same.
+func (b *Bundle) backingEntry(entry Entry, backingFile string) (Entry, error) {
+	if !path.IsAbs(backingFile) {
+		if backingEntry, ok := b.Entry(path.Join(path.Dir(entry.Name), backingFile)); ok {
+			return backingEntry, nil
+		}
+		return Entry{}, fmt.Errorf("backing file %s of %s not found in bundle", backingFile, entry.Name)
+	}
+
+	var matches []Entry
+	for _, candidate := range b.Entries {
+		if path.Base(candidate.Name) == path.Base(backingFile) {
+			matches = append(matches, candidate)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Entry{}, fmt.Errorf("backing file %s of %s not found in bundle", backingFile, entry.Name)
+	case 1:
+		return matches[0], nil
+	default:
+		return Entry{}, fmt.Errorf("backing file %s of %s matches %d entries of the bundle", backingFile, entry.Name, len(matches))
+	}
+}
+
+// Disks returns the entries holding virtual disk images, leaving out the
+// backing files of qcow2 chains since they are read through their overlays.
+func (b *Bundle) Disks() ([]Entry, error) {
+	var candidates []Entry
+	backingFiles := map[string]bool{}
+
+	for _, entry := range b.Entries {
+		extension := strings.ToLower(path.Ext(entry.Name))
+		isDisk := false
+		for _, diskExtension := range diskExtensions {
+			if extension == diskExtension {
+				isDisk = true
+			}
+		}
+		if !isDisk {
+			continue
+		}
+
+		candidates = append(candidates, entry)
+		backingFile, err := qcow2BackingFile(b.Open(entry))
+		if err != nil {
+			return nil, fmt.Errorf("error reading disk %s: %w", entry.Name, err)
+		}
+		// a backing file missing from the bundle fails when the disk is opened
+		if backingFile != "" {
+			if backingEntry, err := b.backingEntry(entry, backingFile); err == nil {
+				backingFiles[backingEntry.Name] = true
+			}
+		}
+	}
+
+	var disks []Entry
+	for _, entry := range candidates {
+		if !backingFiles[entry.Name] {
+			disks = append(disks, entry)
+		}
+	}
+	return disks, nil
+}
+
+// OpenImage opens a disk entry, resolving qcow2 backing files to other
+// entries of the same bundle.
+func (b *Bundle) OpenImage(entry Entry) (Image, error) {
+	return b.openImage(entry, 0)
+}
+
+func (b *Bundle) openImage(entry Entry, depth int) (Image, error) {
+	if depth > 16 {
+		return nil, fmt.Errorf("backing file chain of %s is too deep", entry.Name)
+	}
+
+	return openImage(entry.Name, b.Open(entry), func(backingFile string) (Image, error) {
+		backingEntry, err := b.backingEntry(entry, backingFile)
+		if err != nil {
+			return nil, err
+		}
+		return b.openImage(backingEntry, depth+1)
+	})
+}
+
+// FileSize is the number of bytes a disk takes in the bundle, including the
+// backing files it depends on.
+func (b *Bundle) FileSize(entry Entry) (int64, error) {
+	size := entry.Size
+	for depth := 0; depth <= 16; depth++ {
+		backingFile, err := qcow2BackingFile(b.Open(entry))
+		if err != nil || backingFile == "" {
+			return size, err
+		}
+
+		backingEntry, err := b.backingEntry(entry, backingFile)
+		if err != nil {
+			return size, err
+		}
+		size += backingEntry.Size
+		entry = backingEntry
+	}
+	return size, fmt.Errorf("backing file chain of %s is too deep", entry.Name)
+}
@@ -0,0 +1,39 @@
+package disk
+
+import "testing"
+
+func TestBundleBackingEntry(t *testing.T) {
+	bundle := &Bundle{Entries: []Entry{
+		{Name: "kvm/disk.qcow2"},
+		{Name: "kvm/base.qcow2"},
+		{Name: "vmware/base.qcow2"},
+		{Name: "single/overlay.qcow2"},
+		{Name: "images/unique-base.qcow2"},
+	}}
+
+	tests := []struct {
+		entry       string
+		backingFile string
+		want        string
+		wantErr     bool
+	}{
+		// relative names are relative to the directory of the overlay
+		{entry: "kvm/disk.qcow2", backingFile: "base.qcow2", want: "kvm/base.qcow2"},
+		{entry: "kvm/disk.qcow2", backingFile: "../vmware/base.qcow2", want: "vmware/base.qcow2"},
+		{entry: "single/overlay.qcow2", backingFile: "base.qcow2", wantErr: true},
+		// absolute names from the build host match on a unique base name
+		{entry: "single/overlay.qcow2", backingFile: "/var/lib/libvirt/images/unique-base.qcow2", want: "images/unique-base.qcow2"},
+		{entry: "single/overlay.qcow2", backingFile: "/var/lib/libvirt/images/base.qcow2", wantErr: true},
+		{entry: "single/overlay.qcow2", backingFile: "/var/lib/libvirt/images/missing.qcow2", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := bundle.backingEntry(Entry{Name: test.entry}, test.backingFile)
+		if (err != nil) != test.wantErr {
+			t.Errorf("backingEntry(%q, %q) error = %v, want error %v", test.entry, test.backingFile, err, test.wantErr)
+			continue
+		}
+		if got.Name != test.want {
+			t.Errorf("backingEntry(%q, %q) = %q, want %q", test.entry, test.backingFile, got.Name, test.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package disk
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// Image is a virtual disk whose guest-visible contents can be read at any
+// offset, regardless of how the disk format stores them.
+type Image interface {
+	io.ReaderAt
+	Format() string
+	// Size is the virtual (guest-visible) size of the disk in bytes.
+	Size() int64
+	// Grains lists the virtual ranges that are actually stored in the image
+	// file, together with the number of bytes each occupies on storage.
+	Grains() []Grain
+}
+
+type Grain struct {
+	Offset     int64
+	Length     int64
+	StoredSize int64
+}
+
+func openImage(name string, r *io.SectionReader, openBacking func(string) (Image, error)) (Image, error) {
+	magic := make([]byte, 4)
+	if _, err := r.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error reading magic of disk %s: %w", name, err)
+	}
+
+	switch string(magic) {
+	case vmdkMagic:
+		return openVmdk(r, r.Size())
+	case qcow2Magic:
+		return openQcow2(r, r.Size(), openBacking)
+	default:
+		return openRaw(r, r.Size()), nil
+	}
+}
+
+// OpenImageFile opens a standalone disk image outside of any bundle, so it
+// cannot have a qcow2 backing file.
+func OpenImageFile(imagePath string) (Image, *os.File, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening disk %s: %w", imagePath, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("error reading disk %s: %w", imagePath, err)
+	}
+
+	img, err := openImage(imagePath, io.NewSectionReader(file, 0, info.Size()), func(backingFile string) (Image, error) {
+		return nil, fmt.Errorf("backing file %s of standalone disk %s is not supported", backingFile, imagePath)
+	})
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return img, file, nil
+}
+
+// PopulatedSize is the number of guest bytes actually stored in the image.
+func PopulatedSize(img Image) int64 {
+	var size int64
+	for _, grain := range img.Grains() {
+		size += grain.Length
+	}
+	return size
+}
+
+// NonZeroSize is the number of guest bytes in the grains of the image that
+// aren't all zeroes, it reads the whole image.
+func NonZeroSize(img Image) (int64, error) {
+	var size int64
+	var data []byte
+	for _, grain := range img.Grains() {
+		data = slices.Grow(data[:0], int(grain.Length))[:grain.Length]
+		if _, err := img.ReadAt(data, grain.Offset); err != nil && err != io.EOF {
+			return 0, fmt.Errorf("error reading grain at %d: %w", grain.Offset, err)
+		}
+		if !isZero(data) {
+			size += grain.Length
+		}
+	}
+	return size, nil
+}
+
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,218 @@
+package disk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	ext4SuperblockOffset = 1024
+	ext4Magic            = 0xef53
+
+	ext4CompatSparseSuper2  = 0x200
+	ext4IncompatMetaBg      = 0x10
+	ext4Incompat64Bit       = 0x80
+	ext4RoCompatSparseSuper = 0x1
+
+	ext4GroupBlockUninit = 0x2
+)
+
+type Ext4 struct {
+	BlockSize   int64
+	BlocksCount int64
+	FreeBlocks  int64
+
+	r               io.ReaderAt
+	firstDataBlock  int64
+	blocksPerGroup  int64
+	inodesPerGroup  int64
+	inodeSize       int64
+	featureCompat   uint32
+	featureIncompat uint32
+	featureRoCompat uint32
+	// gdtBlocks are the group descriptor and reserved GDT blocks following
+	// every superblock backup
+	gdtBlocks int64
+	backupBgs [2]int64
+	groups    []ext4Group
+}
+
+type ext4Group struct {
+	blockBitmap int64
+	inodeBitmap int64
+	inodeTable  int64
+	flags       uint16
+}
+
+// IsExt4 reports whether the partition holds an ext2/3/4 filesystem.
+func IsExt4(r io.ReaderAt) bool {
+	magic := make([]byte, 2)
+	if _, err := r.ReadAt(magic, ext4SuperblockOffset+0x38); err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint16(magic) == ext4Magic
+}
+
+func OpenExt4(r io.ReaderAt) (*Ext4, error) {
+	sb := make([]byte, 1024)
+	if _, err := r.ReadAt(sb, ext4SuperblockOffset); err != nil {
+		return nil, fmt.Errorf("error reading ext4 superblock: %w", err)
+	}
+	if binary.LittleEndian.Uint16(sb[0x38:]) != ext4Magic {
+		return nil, fmt.Errorf("invalid ext4 superblock magic")
+	}
+
+	fs := &Ext4{
+		r:               r,
+		BlockSize:       1024 << binary.LittleEndian.Uint32(sb[0x18:]),
+		firstDataBlock:  int64(binary.LittleEndian.Uint32(sb[0x14:])),
+		blocksPerGroup:  int64(binary.LittleEndian.Uint32(sb[0x20:])),
+		inodesPerGroup:  int64(binary.LittleEndian.Uint32(sb[0x28:])),
+		inodeSize:       int64(binary.LittleEndian.Uint16(sb[0x58:])),
+		featureCompat:   binary.LittleEndian.Uint32(sb[0x5c:]),
+		featureIncompat: binary.LittleEndian.Uint32(sb[0x60:]),
+		featureRoCompat: binary.LittleEndian.Uint32(sb[0x64:]),
+		backupBgs: [2]int64{
+			int64(binary.LittleEndian.Uint32(sb[0x24c:])),
+			int64(binary.LittleEndian.Uint32(sb[0x250:])),
+		},
+	}
+
+	fs.BlocksCount = int64(binary.LittleEndian.Uint32(sb[0x4:]))
+	fs.FreeBlocks = int64(binary.LittleEndian.Uint32(sb[0xc:]))
+	descSize := int64(32)
+	if fs.featureIncompat&ext4Incompat64Bit != 0 {
+		fs.BlocksCount |= int64(binary.LittleEndian.Uint32(sb[0x150:])) << 32
+		fs.FreeBlocks |= int64(binary.LittleEndian.Uint32(sb[0x158:])) << 32
+		descSize = int64(binary.LittleEndian.Uint16(sb[0xfe:]))
+	}
+	if descSize < 32 {
+		descSize = 32
+	}
+
+	if fs.featureIncompat&ext4IncompatMetaBg != 0 {
+		return nil, fmt.Errorf("unsupported ext4 feature meta_bg")
+	}
+	if fs.blocksPerGroup == 0 || fs.inodesPerGroup == 0 {
+		return nil, fmt.Errorf("invalid ext4 group geometry")
+	}
+	if fs.inodeSize == 0 {
+		// revision 0 filesystems have fixed size inodes
+		fs.inodeSize = 128
+	}
+
+	groupCount := (fs.BlocksCount - fs.firstDataBlock + fs.blocksPerGroup - 1) / fs.blocksPerGroup
+	fs.gdtBlocks = (groupCount*descSize+fs.BlockSize-1)/fs.BlockSize + int64(binary.LittleEndian.Uint16(sb[0xce:]))
+	descriptors := make([]byte, groupCount*descSize)
+	if _, err := r.ReadAt(descriptors, (fs.firstDataBlock+1)*fs.BlockSize); err != nil {
+		return nil, fmt.Errorf("error reading ext4 group descriptors: %w", err)
+	}
+
+	for i := int64(0); i < groupCount; i++ {
+		desc := descriptors[i*descSize : (i+1)*descSize]
+		group := ext4Group{
+			blockBitmap: int64(binary.LittleEndian.Uint32(desc[0x0:])),
+			inodeBitmap: int64(binary.LittleEndian.Uint32(desc[0x4:])),
+			inodeTable:  int64(binary.LittleEndian.Uint32(desc[0x8:])),
+			flags:       binary.LittleEndian.Uint16(desc[0x12:]),
+		}
+		if descSize >= 64 {
+			group.blockBitmap |= int64(binary.LittleEndian.Uint32(desc[0x20:])) << 32
+			group.inodeBitmap |= int64(binary.LittleEndian.Uint32(desc[0x24:])) << 32
+			group.inodeTable |= int64(binary.LittleEndian.Uint32(desc[0x28:])) << 32
+		}
+		fs.groups = append(fs.groups, group)
+	}
+
+	return fs, nil
+}
+
+// BlockBitmap is the allocation state of every filesystem block.
+type BlockBitmap struct {
+	firstDataBlock int64
+	blocksCount    int64
+	bits           []byte
+}
+
+func (b *BlockBitmap) InUse(block int64) bool {
+	if block < b.firstDataBlock || block >= b.blocksCount {
+		return true
+	}
+	bit := block - b.firstDataBlock
+	return b.bits[bit/8]&(1<<(bit%8)) != 0
+}
+
+func (fs *Ext4) ReadBlockBitmap() (*BlockBitmap, error) {
+	bytesPerGroup := fs.blocksPerGroup / 8
+	bitmap := &BlockBitmap{
+		firstDataBlock: fs.firstDataBlock,
+		blocksCount:    fs.BlocksCount,
+		bits:           make([]byte, int64(len(fs.groups))*bytesPerGroup),
+	}
+
+	for i, group := range fs.groups {
+		// groups flagged BLOCK_UNINIT have never had a data block allocated, so
+		// their bitmap isn't read from disk, only their metadata is in use
+		if group.flags&ext4GroupBlockUninit != 0 {
+			fs.markGroupMetadata(bitmap, int64(i))
+			continue
+		}
+
+		groupBits := bitmap.bits[int64(i)*bytesPerGroup : int64(i+1)*bytesPerGroup]
+		if _, err := fs.r.ReadAt(groupBits, group.blockBitmap*fs.BlockSize); err != nil {
+			return nil, fmt.Errorf("error reading ext4 block bitmap of group %d: %w", i, err)
+		}
+	}
+
+	return bitmap, nil
+}
+
+// markGroupMetadata marks the blocks of a group the kernel marks when it
+// initializes its bitmap: the superblock backup with the group descriptors,
+// and the bitmaps and inode tables that flex_bg didn't move to another group.
+func (fs *Ext4) markGroupMetadata(bitmap *BlockBitmap, groupIndex int64) {
+	groupStart := fs.firstDataBlock + groupIndex*fs.blocksPerGroup
+	groupEnd := groupStart + fs.blocksPerGroup
+	mark := func(start, count int64) {
+		for block := max(start, groupStart); block < min(start+count, groupEnd); block++ {
+			bit := block - fs.firstDataBlock
+			bitmap.bits[bit/8] |= 1 << (bit % 8)
+		}
+	}
+
+	if fs.hasSuperblockBackup(groupIndex) {
+		mark(groupStart, 1+fs.gdtBlocks)
+	}
+	group := fs.groups[groupIndex]
+	mark(group.blockBitmap, 1)
+	mark(group.inodeBitmap, 1)
+	mark(group.inodeTable, (fs.inodesPerGroup*fs.inodeSize+fs.BlockSize-1)/fs.BlockSize)
+}
+
+// hasSuperblockBackup reports whether a group starts with a copy of the
+// superblock, with sparse_super only groups 0, 1 and powers of 3, 5 and 7 do.
+func (fs *Ext4) hasSuperblockBackup(groupIndex int64) bool {
+	if groupIndex == 0 {
+		return true
+	}
+	if fs.featureCompat&ext4CompatSparseSuper2 != 0 {
+		return groupIndex == fs.backupBgs[0] || groupIndex == fs.backupBgs[1]
+	}
+	if groupIndex == 1 || fs.featureRoCompat&ext4RoCompatSparseSuper == 0 {
+		return true
+	}
+	if groupIndex%2 == 0 {
+		return false
+	}
+	for _, base := range []int64{3, 5, 7} {
+		power := base
+		for power < groupIndex {
+			power *= base
+		}
+		if power == groupIndex {
+			return true
+		}
+	}
+	return false
+}
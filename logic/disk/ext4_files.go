@@ -0,0 +1,392 @@
+package disk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	ext4RootInode = 2
+
+	ext4ModeTypeMask = 0xf000
+	ext4ModeDir      = 0x4000
+	ext4ModeRegular  = 0x8000
+	ext4ModeSymlink  = 0xa000
+
+	ext4FlagExtents    = 0x80000
+	ext4FlagInlineData = 0x10000000
+
+	ext4ExtentMagic        = 0xf30a
+	ext4ExtentUninitOffset = 32768
+	ext4ExtentEntrySize    = 12
+	// ext4MaxExtentDepth is the deepest extent tree the kernel accepts
+	ext4MaxExtentDepth = 5
+)
+
+type Inode struct {
+	Number int64
+	Mode   uint16
+	Size   int64
+	Links  uint16
+	flags  uint32
+	block  []byte
+}
+
+func (i *Inode) IsDir() bool {
+	return i.Mode&ext4ModeTypeMask == ext4ModeDir
+}
+
+func (i *Inode) IsRegular() bool {
+	return i.Mode&ext4ModeTypeMask == ext4ModeRegular
+}
+
+func (i *Inode) IsSymlink() bool {
+	return i.Mode&ext4ModeTypeMask == ext4ModeSymlink
+}
+
+// Extent maps a run of file blocks to filesystem blocks. Uninitialized
+// extents are allocated but read as zeroes.
+type Extent struct {
+	Logical  int64
+	Physical int64
+	Length   int64
+	Uninit   bool
+}
+
+type DirEntry struct {
+	Name  string
+	Inode int64
+}
+
+func (fs *Ext4) ReadInode(number int64) (*Inode, error) {
+	group := (number - 1) / fs.inodesPerGroup
+	if group >= int64(len(fs.groups)) {
+		return nil, fmt.Errorf("inode %d out of range", number)
+	}
+	index := (number - 1) % fs.inodesPerGroup
+
+	raw := make([]byte, 0x80)
+	if _, err := fs.r.ReadAt(raw, fs.groups[group].inodeTable*fs.BlockSize+index*fs.inodeSize); err != nil {
+		return nil, fmt.Errorf("error reading inode %d: %w", number, err)
+	}
+
+	return &Inode{
+		Number: number,
+		Mode:   binary.LittleEndian.Uint16(raw[0x0:]),
+		Size:   int64(binary.LittleEndian.Uint32(raw[0x4:])) | int64(binary.LittleEndian.Uint32(raw[0x6c:]))<<32,
+		Links:  binary.LittleEndian.Uint16(raw[0x1a:]),
+		flags:  binary.LittleEndian.Uint32(raw[0x20:]),
+		block:  raw[0x28:0x64],
+	}, nil
+}
+
+// Extents returns the block runs holding the inode data.
+func (fs *Ext4) Extents(inode *Inode) ([]Extent, error) {
+	if inode.flags&ext4FlagInlineData != 0 {
+		return nil, fmt.Errorf("inode %d: inline data is not supported", inode.Number)
+	}
+	if inode.flags&ext4FlagExtents != 0 {
+		return fs.extentTree(inode.block, ext4MaxExtentDepth)
+	}
+	return fs.blockMap(inode)
+}
+
+// extentTree reads the extents below a node of at most maxDepth, every level
+// of the tree must be one less deep than its parent.
+func (fs *Ext4) extentTree(node []byte, maxDepth int) ([]Extent, error) {
+	if binary.LittleEndian.Uint16(node[0:]) != ext4ExtentMagic {
+		return nil, fmt.Errorf("invalid extent header")
+	}
+	entries := int(binary.LittleEndian.Uint16(node[2:]))
+	depth := int(binary.LittleEndian.Uint16(node[6:]))
+	if ext4ExtentEntrySize*(1+entries) > len(node) {
+		return nil, fmt.Errorf("invalid extent node with %d entries", entries)
+	}
+	if depth > maxDepth {
+		return nil, fmt.Errorf("invalid extent node depth %d", depth)
+	}
+
+	var extents []Extent
+	for i := 0; i < entries; i++ {
+		entry := node[ext4ExtentEntrySize*(1+i) : ext4ExtentEntrySize*(2+i)]
+		if depth == 0 {
+			length := int64(binary.LittleEndian.Uint16(entry[4:]))
+			extent := Extent{
+				Logical:  int64(binary.LittleEndian.Uint32(entry[0:])),
+				Physical: int64(binary.LittleEndian.Uint16(entry[6:]))<<32 | int64(binary.LittleEndian.Uint32(entry[8:])),
+				Length:   length,
+			}
+			if length > ext4ExtentUninitOffset {
+				extent.Length -= ext4ExtentUninitOffset
+				extent.Uninit = true
+			}
+			extents = append(extents, extent)
+			continue
+		}
+
+		leaf := int64(binary.LittleEndian.Uint16(entry[8:]))<<32 | int64(binary.LittleEndian.Uint32(entry[4:]))
+		child := make([]byte, fs.BlockSize)
+		if _, err := fs.r.ReadAt(child, leaf*fs.BlockSize); err != nil {
+			return nil, fmt.Errorf("error reading extent node %d: %w", leaf, err)
+		}
+		childExtents, err := fs.extentTree(child, depth-1)
+		if err != nil {
+			return nil, err
+		}
+		extents = append(extents, childExtents...)
+	}
+
+	return extents, nil
+}
+
+// blockMap resolves the direct and indirect block pointers used by ext2/3.
+func (fs *Ext4) blockMap(inode *Inode) ([]Extent, error) {
+	var extents []Extent
+	logical := int64(0)
+	blockCount := (inode.Size + fs.BlockSize - 1) / fs.BlockSize
+
+	add := func(physical int64) {
+		if physical != 0 {
+			last := len(extents) - 1
+			if last >= 0 && extents[last].Physical+extents[last].Length == physical && extents[last].Logical+extents[last].Length == logical {
+				extents[last].Length++
+			} else {
+				extents = append(extents, Extent{Logical: logical, Physical: physical, Length: 1})
+			}
+		}
+		logical++
+	}
+
+	var walk func(block int64, level int) error
+	walk = func(block int64, level int) error {
+		pointersPerBlock := fs.BlockSize / 4
+		if block == 0 {
+			skipped := int64(1)
+			for i := 0; i < level; i++ {
+				skipped *= pointersPerBlock
+			}
+			logical += skipped
+			return nil
+		}
+		if level == 0 {
+			add(block)
+			return nil
+		}
+
+		pointers := make([]uint32, pointersPerBlock)
+		if err := binary.Read(io.NewSectionReader(fs.r, block*fs.BlockSize, fs.BlockSize), binary.LittleEndian, pointers); err != nil {
+			return fmt.Errorf("error reading indirect block %d: %w", block, err)
+		}
+		for _, pointer := range pointers {
+			if logical >= blockCount {
+				return nil
+			}
+			if err := walk(int64(pointer), level-1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := 0; i < 15 && logical < blockCount; i++ {
+		pointer := int64(binary.LittleEndian.Uint32(inode.block[i*4:]))
+		level := 0
+		if i >= 12 {
+			level = i - 11
+		}
+		if err := walk(pointer, level); err != nil {
+			return nil, err
+		}
+	}
+
+	return extents, nil
+}
+
+// ReadFile returns the whole content of a regular file, directory or symlink.
+func (fs *Ext4) ReadFile(inode *Inode) ([]byte, error) {
+	// fast symlinks keep their target inside the inode itself
+	if inode.IsSymlink() && inode.Size < 60 && inode.flags&(ext4FlagExtents|ext4FlagInlineData) == 0 {
+		return append([]byte(nil), inode.block[:inode.Size]...), nil
+	}
+
+	data := make([]byte, inode.Size)
+	if err := fs.CopyFile(inode, sliceWriterAt(data)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// CopyFile writes the allocated parts of a file to w, leaving holes untouched.
+func (fs *Ext4) CopyFile(inode *Inode, w io.WriterAt) error {
+	// inline data larger than the inode block continues in an extended
+	// attribute, which is not read here
+	if inode.flags&ext4FlagInlineData != 0 {
+		_, err := w.WriteAt(inode.block[:min(inode.Size, int64(len(inode.block)))], 0)
+		return err
+	}
+
+	extents, err := fs.Extents(inode)
+	if err != nil {
+		return err
+	}
+
+	for _, extent := range extents {
+		if extent.Uninit {
+			continue
+		}
+		offset := extent.Logical * fs.BlockSize
+		length := min(extent.Length*fs.BlockSize, inode.Size-offset)
+		if length <= 0 {
+			continue
+		}
+
+		section := io.NewSectionReader(fs.r, extent.Physical*fs.BlockSize, length)
+		if _, err := io.Copy(io.NewOffsetWriter(w, offset), section); err != nil {
+			return fmt.Errorf("error copying data of inode %d: %w", inode.Number, err)
+		}
+	}
+
+	return nil
+}
+
+func (fs *Ext4) ReadDir(inode *Inode) ([]DirEntry, error) {
+	data, err := fs.ReadFile(inode)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []DirEntry
+	for pos := 0; pos+8 <= len(data); {
+		number := int64(binary.LittleEndian.Uint32(data[pos:]))
+		recLen := int(binary.LittleEndian.Uint16(data[pos+4:]))
+		nameLen := int(data[pos+6])
+		if recLen < 8 || pos+recLen > len(data) {
+			break
+		}
+
+		if number != 0 && pos+8+nameLen <= len(data) {
+			name := string(data[pos+8 : pos+8+nameLen])
+			// a name can't hold a path, whatever a corrupt directory says
+			if name == "" || strings.ContainsAny(name, "/\x00") {
+				return nil, fmt.Errorf("inode %d: invalid directory entry name %q", inode.Number, name)
+			}
+			if name != "." && name != ".." {
+				entries = append(entries, DirEntry{Name: name, Inode: number})
+			}
+		}
+		pos += recLen
+	}
+
+	return entries, nil
+}
+
+// Lookup resolves an absolute path without following symlinks.
+func (fs *Ext4) Lookup(filePath string) (*Inode, error) {
+	inode, err := fs.ReadInode(ext4RootInode)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range strings.Split(strings.Trim(path.Clean(filePath), "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if !inode.IsDir() {
+			return nil, fmt.Errorf("%s: not a directory", filePath)
+		}
+
+		entries, err := fs.ReadDir(inode)
+		if err != nil {
+			return nil, err
+		}
+
+		found := false
+		for _, entry := range entries {
+			if entry.Name == name {
+				if inode, err = fs.ReadInode(entry.Inode); err != nil {
+					return nil, err
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s: not found", filePath)
+		}
+	}
+
+	return inode, nil
+}
+
+type WalkFunc func(filePath string, inode *Inode) (skipDir bool, err error)
+
+// Walk visits every inode reachable from the root directory, parents first.
+func (fs *Ext4) Walk(fn WalkFunc) error {
+	root, err := fs.ReadInode(ext4RootInode)
+	if err != nil {
+		return err
+	}
+	return fs.walk("/", root, fn, map[int64]bool{})
+}
+
+// walk visits the directories once: they can't be hardlinked, a directory
+// reached twice is a cycle of a corrupt filesystem.
+func (fs *Ext4) walk(dirPath string, dir *Inode, fn WalkFunc, visited map[int64]bool) error {
+	if visited[dir.Number] {
+		return fmt.Errorf("directory %s loops back to inode %d", dirPath, dir.Number)
+	}
+	visited[dir.Number] = true
+
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error reading directory %s: %w", dirPath, err)
+	}
+
+	for _, entry := range entries {
+		inode, err := fs.ReadInode(entry.Inode)
+		if err != nil {
+			return err
+		}
+
+		entryPath := path.Join(dirPath, entry.Name)
+		skipDir, err := fn(entryPath, inode)
+		if err != nil {
+			return err
+		}
+		if inode.IsDir() && !skipDir {
+			if err := fs.walk(entryPath, inode, fn, visited); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// TreeSize sums the sizes of the regular files below a directory.
+func (fs *Ext4) TreeSize(dirPath string, dir *Inode) (int64, error) {
+	var size int64
+	err := fs.walk(dirPath, dir, func(_ string, inode *Inode) (bool, error) {
+		if inode.IsRegular() {
+			size += inode.Size
+		}
+		return false, nil
+	}, map[int64]bool{})
+	return size, err
+}
+
+type sliceWriterAt []byte
+
+func (s sliceWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(s)) {
+		return 0, io.ErrShortWrite
+	}
+	n := copy(s[off:], p)
+	if n < len(p) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
@@ -0,0 +1,152 @@
+package disk
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// makeExt4Image formats a 64MiB ext4 image with mkfs.ext4.
+func makeExt4Image(t *testing.T, options ...string) string {
+	t.Helper()
+	mkfs, err := exec.LookPath("mkfs.ext4")
+	if err != nil {
+		t.Skip("mkfs.ext4 not found")
+	}
+
+	imagePath := filepath.Join(t.TempDir(), "ext4.img")
+	if err := os.WriteFile(imagePath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(imagePath, 64<<20); err != nil {
+		t.Fatal(err)
+	}
+	args := append([]string{"-F", "-q"}, options...)
+	if output, err := exec.Command(mkfs, append(args, imagePath)...).CombinedOutput(); err != nil {
+		t.Fatalf("mkfs.ext4 failed: %v: %s", err, output)
+	}
+	return imagePath
+}
+
+// makeExt4 formats a 64MiB ext4 image with mkfs.ext4 and opens it.
+func makeExt4(t *testing.T, options ...string) *Ext4 {
+	t.Helper()
+	image, err := os.Open(makeExt4Image(t, options...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { image.Close() })
+
+	fs, err := OpenExt4(image)
+	if err != nil {
+		t.Fatalf("OpenExt4() error = %v", err)
+	}
+	return fs
+}
+
+func TestExt4BlockBitmapMatchesFreeBlocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []string
+	}{
+		{name: "flex_bg", options: []string{"-b", "1024"}},
+		{name: "no flex_bg", options: []string{"-b", "1024", "-O", "^flex_bg"}},
+		{name: "no sparse_super", options: []string{"-b", "1024", "-O", "^flex_bg,^resize_inode,^sparse_super"}},
+		{name: "sparse_super2", options: []string{"-b", "1024", "-O", "^flex_bg,^resize_inode,sparse_super2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := makeExt4(t, test.options...)
+			bitmap, err := fs.ReadBlockBitmap()
+			if err != nil {
+				t.Fatalf("ReadBlockBitmap() error = %v", err)
+			}
+
+			var uninitGroups int
+			for _, group := range fs.groups {
+				if group.flags&ext4GroupBlockUninit != 0 {
+					uninitGroups++
+				}
+			}
+			if uninitGroups == 0 {
+				t.Fatalf("no BLOCK_UNINIT group to test")
+			}
+
+			var freeBlocks int64
+			for block := fs.firstDataBlock; block < fs.BlocksCount; block++ {
+				if !bitmap.InUse(block) {
+					freeBlocks++
+				}
+			}
+			if freeBlocks != fs.FreeBlocks {
+				t.Errorf("free blocks in bitmap = %d, superblock free blocks = %d", freeBlocks, fs.FreeBlocks)
+			}
+		})
+	}
+}
+
+func TestExt4HasSuperblockBackup(t *testing.T) {
+	tests := []struct {
+		name   string
+		fs     Ext4
+		groups map[int64]bool
+	}{
+		{
+			name:   "sparse_super",
+			fs:     Ext4{featureRoCompat: ext4RoCompatSparseSuper},
+			groups: map[int64]bool{0: true, 1: true, 2: false, 3: true, 4: false, 5: true, 7: true, 9: true, 15: false, 25: true, 27: true, 49: true, 50: false},
+		},
+		{
+			name:   "no sparse_super",
+			fs:     Ext4{},
+			groups: map[int64]bool{0: true, 1: true, 2: true, 4: true, 6: true},
+		},
+		{
+			name:   "sparse_super2",
+			fs:     Ext4{featureCompat: ext4CompatSparseSuper2, backupBgs: [2]int64{1, 6}},
+			groups: map[int64]bool{0: true, 1: true, 3: false, 6: true, 7: false},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for group, want := range test.groups {
+				if got := test.fs.hasSuperblockBackup(group); got != want {
+					t.Errorf("hasSuperblockBackup(%d) = %v, want %v", group, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExtentTreeRejectsCorruptNodes(t *testing.T) {
+	node := func(entries, depth uint16) []byte {
+		block := make([]byte, 60)
+		binary.LittleEndian.PutUint16(block[0:], ext4ExtentMagic)
+		binary.LittleEndian.PutUint16(block[2:], entries)
+		binary.LittleEndian.PutUint16(block[6:], depth)
+		return block
+	}
+
+	tests := []struct {
+		name    string
+		node    []byte
+		wantErr bool
+	}{
+		{name: "empty leaf", node: node(0, 0)},
+		{name: "full leaf", node: node(4, 0)},
+		{name: "more entries than the node holds", node: node(5, 0), wantErr: true},
+		{name: "too deep", node: node(1, ext4MaxExtentDepth+1), wantErr: true},
+		{name: "bad magic", node: make([]byte, 60), wantErr: true},
+	}
+	fs := &Ext4{BlockSize: 1024}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := fs.extentTree(test.node, ext4MaxExtentDepth)
+			if (err != nil) != test.wantErr {
+				t.Errorf("extentTree() error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
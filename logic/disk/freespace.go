@@ -0,0 +1,204 @@
+package disk
+
+import (
+	"fmt"
+	"io"
+)
+
+type FreeSpaceReport struct {
+	Bundle           string
+	Disk             string
+	Format           string
+	FileSize         int64
+	VirtualSize      int64
+	StoredSize       int64
+	UsedBytes        int64
+	AllocatedGrains  int
+	Partitions       []PartitionFreeSpace
+	EstimatedSavings int64
+	// SparseSavings is set for raw images instead of EstimatedSavings:
+	// trimming does not shrink a raw file, converting it to a sparse or
+	// compressed format drops the bytes no filesystem uses
+	SparseSavings int64
+}
+
+type PartitionFreeSpace struct {
+	Partition  Partition
+	Filesystem string
+	FreeBytes  int64
+
+	// grains lying entirely in blocks the filesystem considers free
+	FreeGrains        int
+	FreeNonZeroGrains int
+	FreeStoredBytes   int64
+
+	// grains mixing used blocks with free blocks that still hold data
+	PartialGrains       int
+	PartialNonZeroBytes int64
+
+	EstimatedSavings int64
+}
+
+func AnalyzeFreeSpace(bundlePath string) ([]*FreeSpaceReport, error) {
+	fmt.Println("Started analyzing free space of bundle disks:", bundlePath)
+
+	bundle, err := OpenBundle(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	defer bundle.Close()
+
+	disks, err := bundle.Disks()
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []*FreeSpaceReport
+	for _, entry := range disks {
+		fmt.Println("Analyzing free space of disk:", entry.Name)
+
+		img, err := bundle.OpenImage(entry)
+		if err != nil {
+			return nil, fmt.Errorf("error opening disk %s: %w", entry.Name, err)
+		}
+
+		report, err := analyzeImageFreeSpace(entry.Name, img)
+		if err != nil {
+			return nil, fmt.Errorf("error analyzing free space of disk %s: %w", entry.Name, err)
+		}
+
+		report.Bundle = bundlePath
+		if report.FileSize, err = bundle.FileSize(entry); err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	fmt.Println("Finished analyzing free space successfully.")
+	return reports, nil
+}
+
+func analyzeImageFreeSpace(name string, img Image) (*FreeSpaceReport, error) {
+	grains := img.Grains()
+	report := &FreeSpaceReport{
+		Disk:            name,
+		Format:          img.Format(),
+		VirtualSize:     img.Size(),
+		AllocatedGrains: len(grains),
+	}
+	for _, grain := range grains {
+		report.StoredSize += grain.StoredSize
+	}
+
+	partitions, err := ReadPartitions(img)
+	if err != nil {
+		return nil, err
+	}
+
+	// the bytes of unsupported partitions are counted as used
+	var unsupportedBytes int64
+	for _, partition := range partitions {
+		partitionReader := io.NewSectionReader(img, partition.Offset, partition.Size)
+		if !IsExt4(partitionReader) {
+			report.Partitions = append(report.Partitions, PartitionFreeSpace{Partition: partition, Filesystem: "unsupported"})
+			unsupportedBytes += partition.Size
+			continue
+		}
+
+		fs, err := OpenExt4(partitionReader)
+		if err != nil {
+			return nil, fmt.Errorf("error opening filesystem of partition %d: %w", partition.Index, err)
+		}
+
+		partitionFreeSpace, err := analyzeExt4FreeSpace(img, grains, partition, fs)
+		if err != nil {
+			return nil, fmt.Errorf("error analyzing partition %d: %w", partition.Index, err)
+		}
+
+		report.Partitions = append(report.Partitions, *partitionFreeSpace)
+		report.UsedBytes += (fs.BlocksCount - fs.FreeBlocks) * fs.BlockSize
+		report.EstimatedSavings += partitionFreeSpace.EstimatedSavings
+	}
+
+	if report.Format == "raw" {
+		report.SparseSavings = max(report.StoredSize-report.UsedBytes-unsupportedBytes, 0)
+		report.EstimatedSavings = 0
+	}
+	return report, nil
+}
+
+func analyzeExt4FreeSpace(img Image, grains []Grain, partition Partition, fs *Ext4) (*PartitionFreeSpace, error) {
+	bitmap, err := fs.ReadBlockBitmap()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PartitionFreeSpace{
+		Partition:  partition,
+		Filesystem: "ext4",
+		FreeBytes:  fs.FreeBlocks * fs.BlockSize,
+	}
+
+	partitionEnd := partition.Offset + partition.Size
+	for _, grain := range grains {
+		grainEnd := grain.Offset + grain.Length
+		if grainEnd <= partition.Offset || grain.Offset >= partitionEnd {
+			continue
+		}
+
+		allFree := grain.Offset >= partition.Offset && grainEnd <= partitionEnd
+		anyFree := false
+		firstBlock := max(grain.Offset-partition.Offset, 0) / fs.BlockSize
+		lastBlock := (min(grainEnd, partitionEnd) - partition.Offset - 1) / fs.BlockSize
+		for block := firstBlock; block <= lastBlock; block++ {
+			if bitmap.InUse(block) {
+				allFree = false
+			} else {
+				anyFree = true
+			}
+		}
+
+		if !anyFree {
+			continue
+		}
+
+		data := make([]byte, grain.Length)
+		if _, err := img.ReadAt(data, grain.Offset); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading grain at %d: %w", grain.Offset, err)
+		}
+
+		if allFree {
+			result.FreeGrains++
+			result.FreeStoredBytes += grain.StoredSize
+			// zeroed grains are already dropped from a streamOptimized export,
+			// trimming only saves the ones holding stale data
+			if !isZero(data) {
+				result.FreeNonZeroGrains++
+				result.EstimatedSavings += grain.StoredSize
+			}
+			continue
+		}
+
+		var nonZeroFreeBytes int64
+		for block := firstBlock; block <= lastBlock; block++ {
+			if bitmap.InUse(block) {
+				continue
+			}
+			blockStart := partition.Offset + block*fs.BlockSize - grain.Offset
+			start := max(blockStart, 0)
+			end := min(blockStart+fs.BlockSize, grain.Length)
+			if !isZero(data[start:end]) {
+				nonZeroFreeBytes += end - start
+			}
+		}
+
+		if nonZeroFreeBytes > 0 {
+			result.PartialGrains++
+			result.PartialNonZeroBytes += nonZeroFreeBytes
+			// assume the stale data compresses like the rest of the grain
+			result.EstimatedSavings += grain.StoredSize * nonZeroFreeBytes / grain.Length
+		}
+	}
+
+	return result, nil
+}
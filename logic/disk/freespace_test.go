@@ -0,0 +1,75 @@
+package disk
+
+import (
+	"os"
+	"testing"
+)
+
+func TestAnalyzeExt4FreeSpaceSkipsZeroedGrains(t *testing.T) {
+	imagePath := makeExt4Image(t)
+	img, file, err := OpenImageFile(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	fs, err := OpenExt4(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bitmap, err := fs.ReadBlockBitmap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	partition := Partition{Offset: 0, Size: img.Size(), Type: "none"}
+
+	// the free blocks of a new filesystem are zeroes, trimming saves nothing
+	result, err := analyzeExt4FreeSpace(img, img.Grains(), partition, fs)
+	if err != nil {
+		t.Fatalf("analyzeExt4FreeSpace() error = %v", err)
+	}
+	if result.FreeGrains == 0 || result.EstimatedSavings != 0 {
+		t.Fatalf("new filesystem: %d free grains, saving %d, want free grains and no saving", result.FreeGrains, result.EstimatedSavings)
+	}
+
+	// stale data in a free grain is what a trim drops
+	var staleGrain *Grain
+	for _, grain := range img.Grains() {
+		free := true
+		for block := grain.Offset / fs.BlockSize; block < (grain.Offset+grain.Length)/fs.BlockSize; block++ {
+			free = free && !bitmap.InUse(block)
+		}
+		if free {
+			staleGrain = &grain
+			break
+		}
+	}
+	if staleGrain == nil {
+		t.Fatal("no free grain to test")
+	}
+	writer, err := os.OpenFile(imagePath, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.WriteAt([]byte("stale"), staleGrain.Offset+100); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	result, err = analyzeExt4FreeSpace(img, img.Grains(), partition, fs)
+	if err != nil {
+		t.Fatalf("analyzeExt4FreeSpace() error = %v", err)
+	}
+	if result.FreeNonZeroGrains != 1 || result.EstimatedSavings != staleGrain.StoredSize {
+		t.Errorf("stale grain: %d non-zero free grains, saving %d, want 1 and %d", result.FreeNonZeroGrains, result.EstimatedSavings, staleGrain.StoredSize)
+	}
+
+	// trimming a raw image does not shrink it, converting it does
+	report, err := analyzeImageFreeSpace("ext4.img", img)
+	if err != nil {
+		t.Fatalf("analyzeImageFreeSpace() error = %v", err)
+	}
+	if report.EstimatedSavings != 0 || report.SparseSavings != img.Size()-report.UsedBytes {
+		t.Errorf("raw image: saving %d, sparse saving %d, want 0 and %d", report.EstimatedSavings, report.SparseSavings, img.Size()-report.UsedBytes)
+	}
+}
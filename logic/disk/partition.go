@@ -0,0 +1,199 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	mbrTypeExtendedChs = 0x05
+	mbrTypeExtendedLba = 0x0f
+	mbrTypeLinux       = 0x83
+	mbrTypeLinuxLvm    = 0x8e
+	mbrTypeGptProtect  = 0xee
+
+	gptTypeLinuxFs  = "0FC63DAF-8483-4772-8E79-3D69D8477DE4"
+	gptTypeLinuxLvm = "E6D6D379-F507-44C2-A23C-238F2A3DF928"
+
+	// logical partitions are numbered from 5, after the 4 primary ones
+	mbrFirstLogicalIndex = 5
+	// maxLogicalPartitions bounds the EBR chain of corrupt disks
+	maxLogicalPartitions = 128
+
+	gptMinEntrySize = 128
+	// gptMaxEntriesSize bounds the partition entry array read from the header,
+	// the usual 128 entries take 16KiB
+	gptMaxEntriesSize = 1 << 20
+)
+
+type Partition struct {
+	Index  int
+	Offset int64
+	Size   int64
+	Type   string
+}
+
+// ReadPartitions returns the partitions of an MBR or GPT partitioned disk.
+// A disk without a partition table is reported as a single partition.
+func ReadPartitions(img Image) ([]Partition, error) {
+	mbr := make([]byte, sectorSize)
+	if _, err := img.ReadAt(mbr, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error reading mbr: %w", err)
+	}
+
+	if mbr[510] != 0x55 || mbr[511] != 0xaa {
+		return []Partition{{Index: 0, Offset: 0, Size: img.Size(), Type: "none"}}, nil
+	}
+
+	var partitions []Partition
+	for i := 0; i < 4; i++ {
+		entry := mbr[446+i*16 : 446+(i+1)*16]
+		partType := entry[4]
+		start := int64(binary.LittleEndian.Uint32(entry[8:12])) * sectorSize
+		size := int64(binary.LittleEndian.Uint32(entry[12:16])) * sectorSize
+
+		switch partType {
+		case 0:
+			continue
+		case mbrTypeGptProtect:
+			return readGptPartitions(img)
+		case mbrTypeExtendedChs, mbrTypeExtendedLba:
+			logical, err := readLogicalPartitions(img, start, size)
+			if err != nil {
+				return nil, err
+			}
+			partitions = append(partitions, logical...)
+		default:
+			partitions = append(partitions, Partition{Index: i + 1, Offset: start, Size: size, Type: mbrTypeName(partType)})
+		}
+	}
+
+	return partitions, nil
+}
+
+// readLogicalPartitions follows the EBR chain of an extended partition, the
+// next EBR of each one must lie further in the extended partition.
+func readLogicalPartitions(img Image, extendedStart, extendedSize int64) ([]Partition, error) {
+	var partitions []Partition
+	ebr := make([]byte, sectorSize)
+	ebrOffset := extendedStart
+	visited := map[int64]bool{}
+
+	for index := mbrFirstLogicalIndex; ; index++ {
+		if visited[ebrOffset] {
+			return nil, fmt.Errorf("ebr chain loops back to %d", ebrOffset)
+		}
+		if index-mbrFirstLogicalIndex >= maxLogicalPartitions {
+			return nil, fmt.Errorf("more than %d logical partitions", maxLogicalPartitions)
+		}
+		visited[ebrOffset] = true
+
+		if _, err := img.ReadAt(ebr, ebrOffset); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading ebr at %d: %w", ebrOffset, err)
+		}
+		if ebr[510] != 0x55 || ebr[511] != 0xaa {
+			return partitions, nil
+		}
+
+		entry := ebr[446:462]
+		if entry[4] != 0 {
+			partitions = append(partitions, Partition{
+				Index:  index,
+				Offset: ebrOffset + int64(binary.LittleEndian.Uint32(entry[8:12]))*sectorSize,
+				Size:   int64(binary.LittleEndian.Uint32(entry[12:16])) * sectorSize,
+				Type:   mbrTypeName(entry[4]),
+			})
+		}
+
+		next := ebr[462:478]
+		if next[4] == 0 {
+			return partitions, nil
+		}
+		nextOffset := int64(binary.LittleEndian.Uint32(next[8:12])) * sectorSize
+		if nextOffset == 0 || nextOffset >= extendedSize {
+			return nil, fmt.Errorf("ebr at %d points outside of the extended partition", ebrOffset)
+		}
+		ebrOffset = extendedStart + nextOffset
+	}
+}
+
+func readGptPartitions(img Image) ([]Partition, error) {
+	header := make([]byte, sectorSize)
+	if _, err := img.ReadAt(header, sectorSize); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error reading gpt header: %w", err)
+	}
+	if !bytes.Equal(header[0:8], []byte("EFI PART")) {
+		return nil, fmt.Errorf("invalid gpt header signature")
+	}
+
+	firstUsableOffset := int64(binary.LittleEndian.Uint64(header[40:48])) * sectorSize
+	entriesOffset := int64(binary.LittleEndian.Uint64(header[72:80])) * sectorSize
+	entryCount := int64(binary.LittleEndian.Uint32(header[80:84]))
+	entrySize := int64(binary.LittleEndian.Uint32(header[84:88]))
+	if entrySize < gptMinEntrySize {
+		return nil, fmt.Errorf("invalid gpt entry size %d", entrySize)
+	}
+	// the entries of the primary header lie before the first usable LBA
+	if entryCount*entrySize > gptMaxEntriesSize || entriesOffset+entryCount*entrySize > firstUsableOffset {
+		return nil, fmt.Errorf("invalid gpt entry count %d", entryCount)
+	}
+
+	entries := make([]byte, entryCount*entrySize)
+	if _, err := img.ReadAt(entries, entriesOffset); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error reading gpt entries: %w", err)
+	}
+
+	var partitions []Partition
+	for i := int64(0); i < entryCount; i++ {
+		entry := entries[i*entrySize : (i+1)*entrySize]
+		typeGuid := formatGuid(entry[0:16])
+		if typeGuid == "00000000-0000-0000-0000-000000000000" {
+			continue
+		}
+
+		firstLba := int64(binary.LittleEndian.Uint64(entry[32:40]))
+		lastLba := int64(binary.LittleEndian.Uint64(entry[40:48]))
+		partitions = append(partitions, Partition{
+			Index:  int(i) + 1,
+			Offset: firstLba * sectorSize,
+			Size:   (lastLba - firstLba + 1) * sectorSize,
+			Type:   gptTypeName(typeGuid),
+		})
+	}
+
+	return partitions, nil
+}
+
+// formatGuid renders a GPT mixed-endian GUID in its canonical form.
+func formatGuid(b []byte) string {
+	return strings.ToUpper(fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10], b[10:16]))
+}
+
+func mbrTypeName(partType byte) string {
+	switch partType {
+	case mbrTypeLinux:
+		return "linux"
+	case mbrTypeLinuxLvm:
+		return "lvm"
+	default:
+		return fmt.Sprintf("mbr-0x%02x", partType)
+	}
+}
+
+func gptTypeName(typeGuid string) string {
+	switch typeGuid {
+	case gptTypeLinuxFs:
+		return "linux"
+	case gptTypeLinuxLvm:
+		return "lvm"
+	default:
+		return typeGuid
+	}
+}
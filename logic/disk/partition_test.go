@@ -0,0 +1,111 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+const testDiskSize = 1 << 20
+
+// setMbrEntry writes the partition entry i of the MBR or EBR at offset.
+func setMbrEntry(disk []byte, offset int64, i int, partType byte, startSector, sectors uint32) {
+	entry := disk[offset+446+int64(i)*16:]
+	entry[4] = partType
+	binary.LittleEndian.PutUint32(entry[8:], startSector)
+	binary.LittleEndian.PutUint32(entry[12:], sectors)
+	disk[offset+510], disk[offset+511] = 0x55, 0xaa
+}
+
+func TestReadPartitionsLogical(t *testing.T) {
+	// the extended partition spans sectors 100 to 999, with logical
+	// partitions behind EBRs at sectors 100 and 300
+	extended := func() []byte {
+		disk := make([]byte, testDiskSize)
+		setMbrEntry(disk, 0, 0, mbrTypeLinux, 2, 98)
+		setMbrEntry(disk, 0, 1, mbrTypeExtendedLba, 100, 900)
+		setMbrEntry(disk, 100*sectorSize, 0, mbrTypeLinux, 1, 99)
+		setMbrEntry(disk, 300*sectorSize, 0, mbrTypeLinuxLvm, 1, 99)
+		return disk
+	}
+
+	tests := []struct {
+		name    string
+		hasNext bool
+		next    uint32 // sector of the EBR after the one at 300, from the extended start
+		want    []Partition
+		wantErr bool
+	}{
+		{
+			name: "chain",
+			want: []Partition{
+				{Index: 1, Offset: 2 * sectorSize, Size: 98 * sectorSize, Type: "linux"},
+				{Index: 5, Offset: 101 * sectorSize, Size: 99 * sectorSize, Type: "linux"},
+				{Index: 6, Offset: 301 * sectorSize, Size: 99 * sectorSize, Type: "lvm"},
+			},
+		},
+		{name: "loop to the first ebr", hasNext: true, next: 0, wantErr: true},
+		{name: "loop to itself", hasNext: true, next: 200, wantErr: true},
+		{name: "outside of the extended partition", hasNext: true, next: 900, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			disk := extended()
+			setMbrEntry(disk, 100*sectorSize, 1, mbrTypeExtendedChs, 200, 100)
+			if test.hasNext {
+				setMbrEntry(disk, 300*sectorSize, 1, mbrTypeExtendedChs, test.next, 100)
+			}
+
+			got, err := ReadPartitions(openRaw(bytes.NewReader(disk), testDiskSize))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ReadPartitions() error = %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ReadPartitions() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadPartitionsGptHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		entryCount  uint32
+		entrySize   uint32
+		firstUsable uint64
+		wantErr     bool
+	}{
+		{name: "standard", entryCount: 128, entrySize: 128, firstUsable: 34},
+		{name: "entry size too small", entryCount: 128, entrySize: 16, firstUsable: 34, wantErr: true},
+		{name: "entries past the first usable lba", entryCount: 256, entrySize: 128, firstUsable: 34, wantErr: true},
+		{name: "huge entry array", entryCount: 1 << 31, entrySize: 1 << 16, firstUsable: 1 << 40, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			disk := make([]byte, testDiskSize)
+			setMbrEntry(disk, 0, 0, mbrTypeGptProtect, 1, testDiskSize/sectorSize-1)
+			header := disk[sectorSize:]
+			copy(header, "EFI PART")
+			binary.LittleEndian.PutUint64(header[40:], test.firstUsable)
+			binary.LittleEndian.PutUint64(header[72:], 2)
+			binary.LittleEndian.PutUint32(header[80:], test.entryCount)
+			binary.LittleEndian.PutUint32(header[84:], test.entrySize)
+
+			// a single linux partition from sector 34 to 2047
+			entry := disk[2*sectorSize:]
+			copy(entry, []byte{0xaf, 0x3d, 0xc6, 0x0f, 0x83, 0x84, 0x72, 0x47, 0x8e, 0x79, 0x3d, 0x69, 0xd8, 0x47, 0x7d, 0xe4})
+			binary.LittleEndian.PutUint64(entry[32:], 34)
+			binary.LittleEndian.PutUint64(entry[40:], 2047)
+
+			got, err := ReadPartitions(openRaw(bytes.NewReader(disk), testDiskSize))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ReadPartitions() error = %v, want error %v", err, test.wantErr)
+			}
+			want := []Partition{{Index: 1, Offset: 34 * sectorSize, Size: 2014 * sectorSize, Type: "linux"}}
+			if !test.wantErr && !reflect.DeepEqual(got, want) {
+				t.Errorf("ReadPartitions() = %v, want %v", got, want)
+			}
+		})
+	}
+}
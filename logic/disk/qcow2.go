@@ -0,0 +1,295 @@
+package disk
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	qcow2Magic = "QFI\xfb"
+
+	qcow2OffsetMask     = 0x00fffffffffffe00
+	qcow2FlagCompressed = 1 << 62
+	qcow2FlagZero       = 1
+
+	qcow2IncompatExtendedL2 = 1 << 4
+	qcow2CompressionZstd    = 1
+)
+
+type Qcow2 struct {
+	r               io.ReaderAt
+	size            int64
+	clusterBits     uint32
+	clusterSize     int64
+	compressionType byte
+	clusters        map[int64]uint64
+	backing         Image
+
+	mu            sync.Mutex
+	cachedIndex   int64
+	cachedCluster []byte
+}
+
+func qcow2BackingFile(r io.ReaderAt) (string, error) {
+	header := make([]byte, 20)
+	if _, err := r.ReadAt(header, 0); err != nil && err != io.EOF {
+		return "", err
+	}
+	if string(header[0:4]) != qcow2Magic {
+		return "", nil
+	}
+
+	offset := int64(binary.BigEndian.Uint64(header[8:]))
+	size := int64(binary.BigEndian.Uint32(header[16:]))
+	if offset == 0 || size == 0 {
+		return "", nil
+	}
+
+	name := make([]byte, size)
+	if _, err := r.ReadAt(name, offset); err != nil {
+		return "", fmt.Errorf("error reading qcow2 backing file name: %w", err)
+	}
+	return string(name), nil
+}
+
+func openQcow2(r io.ReaderAt, fileSize int64, openBacking func(string) (Image, error)) (*Qcow2, error) {
+	header := make([]byte, 112)
+	if _, err := r.ReadAt(header, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error reading qcow2 header: %w", err)
+	}
+
+	version := binary.BigEndian.Uint32(header[4:])
+	q := &Qcow2{
+		r:           r,
+		size:        int64(binary.BigEndian.Uint64(header[24:])),
+		clusterBits: binary.BigEndian.Uint32(header[20:]),
+		clusters:    map[int64]uint64{},
+		cachedIndex: -1,
+	}
+	if q.clusterBits < 9 || q.clusterBits > 21 {
+		return nil, fmt.Errorf("invalid qcow2 cluster bits %d", q.clusterBits)
+	}
+	q.clusterSize = 1 << q.clusterBits
+
+	if binary.BigEndian.Uint32(header[32:]) != 0 {
+		return nil, fmt.Errorf("encrypted qcow2 images are not supported")
+	}
+	if version >= 3 {
+		if binary.BigEndian.Uint64(header[72:])&qcow2IncompatExtendedL2 != 0 {
+			return nil, fmt.Errorf("qcow2 extended L2 entries are not supported")
+		}
+		if binary.BigEndian.Uint32(header[100:]) > 104 {
+			q.compressionType = header[104]
+		}
+	}
+
+	backingFile, err := qcow2BackingFile(r)
+	if err != nil {
+		return nil, err
+	}
+	if backingFile != "" {
+		if q.backing, err = openBacking(backingFile); err != nil {
+			return nil, err
+		}
+	}
+
+	l1Size := int64(binary.BigEndian.Uint32(header[36:]))
+	l1Offset := int64(binary.BigEndian.Uint64(header[40:]))
+	if l1Offset < 0 || l1Offset+l1Size*8 > fileSize {
+		return nil, fmt.Errorf("qcow2 L1 table of %d entries at %d is beyond the end of the file", l1Size, l1Offset)
+	}
+	l1 := make([]uint64, l1Size)
+	if err := binary.Read(io.NewSectionReader(r, l1Offset, l1Size*8), binary.BigEndian, l1); err != nil {
+		return nil, fmt.Errorf("error reading qcow2 L1 table: %w", err)
+	}
+
+	l2Entries := q.clusterSize / 8
+	l2 := make([]uint64, l2Entries)
+	for l1Index, l1Entry := range l1 {
+		l2Offset := int64(l1Entry & qcow2OffsetMask)
+		if l2Offset == 0 {
+			continue
+		}
+		if err := binary.Read(io.NewSectionReader(r, l2Offset, q.clusterSize), binary.BigEndian, l2); err != nil {
+			return nil, fmt.Errorf("error reading qcow2 L2 table %d: %w", l1Index, err)
+		}
+
+		for l2Index, l2Entry := range l2 {
+			// entries without data, zero or compressed bits are unallocated
+			if l2Entry&(qcow2OffsetMask|qcow2FlagZero|qcow2FlagCompressed) != 0 {
+				q.clusters[int64(l1Index)*l2Entries+int64(l2Index)] = l2Entry
+			}
+		}
+	}
+
+	return q, nil
+}
+
+func (q *Qcow2) Format() string {
+	return "qcow2"
+}
+
+func (q *Qcow2) Size() int64 {
+	return q.size
+}
+
+func (q *Qcow2) compressedLocation(entry uint64) (int64, int64) {
+	offsetBits := 62 - (q.clusterBits - 8)
+	offset := int64(entry & (1<<offsetBits - 1))
+	sectors := int64((entry >> offsetBits) & (1<<(q.clusterBits-8) - 1))
+	return offset, (sectors+1)*sectorSize - offset%sectorSize
+}
+
+// Grains lists the clusters stored in this image and, for the parts it does
+// not override, the grains of its backing chain.
+func (q *Qcow2) Grains() []Grain {
+	var grains []Grain
+	for index, entry := range q.clusters {
+		grain := Grain{Offset: index * q.clusterSize, Length: q.clusterSize, StoredSize: q.clusterSize}
+		switch {
+		case entry&qcow2FlagCompressed != 0:
+			_, grain.StoredSize = q.compressedLocation(entry)
+		case entry&qcow2FlagZero != 0:
+			continue
+		}
+		grains = append(grains, grain)
+	}
+
+	if q.backing != nil {
+		for _, grain := range q.backing.Grains() {
+			grains = append(grains, q.backingGrainParts(grain)...)
+		}
+	}
+
+	sort.Slice(grains, func(i, j int) bool {
+		return grains[i].Offset < grains[j].Offset
+	})
+	return grains
+}
+
+// backingGrainParts returns the parts of a grain of the backing file that no
+// cluster of this image overrides. A backing file with larger clusters, or a
+// raw one, has grains spanning several clusters of this image: the stored
+// size of each part is its share of the grain's.
+func (q *Qcow2) backingGrainParts(grain Grain) []Grain {
+	var parts []Grain
+	grainEnd := grain.Offset + grain.Length
+	for start := grain.Offset; start < grainEnd; {
+		index := start / q.clusterSize
+		end := min((index+1)*q.clusterSize, grainEnd)
+		if _, overridden := q.clusters[index]; !overridden {
+			if last := len(parts) - 1; last >= 0 && parts[last].Offset+parts[last].Length == start {
+				parts[last].Length += end - start
+			} else {
+				parts = append(parts, Grain{Offset: start, Length: end - start})
+			}
+		}
+		start = end
+	}
+
+	for i := range parts {
+		if parts[i].Length == grain.Length {
+			parts[i].StoredSize = grain.StoredSize
+		} else {
+			parts[i].StoredSize = grain.StoredSize * parts[i].Length / grain.Length
+		}
+	}
+	return parts
+}
+
+func (q *Qcow2) ReadAt(p []byte, off int64) (int, error) {
+	if off >= q.size {
+		return 0, io.EOF
+	}
+
+	read := 0
+	for read < len(p) && off < q.size {
+		index := off / q.clusterSize
+		inCluster := off % q.clusterSize
+
+		data, err := q.readCluster(index)
+		if err != nil {
+			return read, err
+		}
+
+		n := copy(p[read:], data[inCluster:])
+		read += n
+		off += int64(n)
+	}
+
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+func (q *Qcow2) readCluster(index int64) ([]byte, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.cachedIndex == index {
+		return q.cachedCluster, nil
+	}
+
+	data := make([]byte, q.clusterSize)
+	entry, ok := q.clusters[index]
+	switch {
+	case !ok:
+		// unallocated clusters are read from the backing file, if any
+		if q.backing != nil {
+			if _, err := q.backing.ReadAt(data, index*q.clusterSize); err != nil && err != io.EOF {
+				return nil, err
+			}
+		}
+	case entry&qcow2FlagCompressed != 0:
+		offset, size := q.compressedLocation(entry)
+		compressed := make([]byte, size)
+		if _, err := q.r.ReadAt(compressed, offset); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading qcow2 cluster %d: %w", index, err)
+		}
+		if err := q.decompress(compressed, data); err != nil {
+			return nil, fmt.Errorf("error decompressing qcow2 cluster %d: %w", index, err)
+		}
+	case entry&qcow2FlagZero != 0:
+		// zero clusters read as zeroes
+	default:
+		if _, err := q.r.ReadAt(data, int64(entry&qcow2OffsetMask)); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading qcow2 cluster %d: %w", index, err)
+		}
+	}
+
+	q.cachedIndex = index
+	q.cachedCluster = data
+	return data, nil
+}
+
+func (q *Qcow2) decompress(compressed, data []byte) error {
+	if q.compressionType == qcow2CompressionZstd {
+		decoder, err := zstd.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return err
+		}
+		defer decoder.Close()
+
+		if _, err := io.ReadFull(decoder, data); err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		return nil
+	}
+
+	// qcow2 stores raw deflate streams without zlib framing
+	decoder := flate.NewReader(bytes.NewReader(compressed))
+	defer decoder.Close()
+
+	if _, err := io.ReadFull(decoder, data); err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	return nil
+}
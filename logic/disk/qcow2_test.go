@@ -0,0 +1,264 @@
+package disk
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const testQcow2ClusterBits = 9
+
+// testCluster is a guest cluster of a test qcow2 image, filled with fill.
+type testCluster struct {
+	kind string // "data", "zero", "compressed" or "" for unallocated
+	fill byte
+}
+
+// makeQcow2 builds a qcow2 v3 image of 512 byte clusters: the header, the L1
+// table and the single L2 table take the first three clusters, the data of
+// the guest clusters follows. Compressed clusters start 100 bytes into their
+// host cluster, to check the offset within the sector is accounted for.
+func makeQcow2(t *testing.T, compressionType byte, backingFile string, clusters []testCluster) []byte {
+	t.Helper()
+	clusterSize := 1 << testQcow2ClusterBits
+
+	image := make([]byte, 3*clusterSize)
+	copy(image, qcow2Magic)
+	binary.BigEndian.PutUint32(image[4:], 3)
+	if backingFile != "" {
+		binary.BigEndian.PutUint64(image[8:], 200)
+		binary.BigEndian.PutUint32(image[16:], uint32(len(backingFile)))
+		copy(image[200:], backingFile)
+	}
+	binary.BigEndian.PutUint32(image[20:], testQcow2ClusterBits)
+	binary.BigEndian.PutUint64(image[24:], uint64(len(clusters)*clusterSize))
+	binary.BigEndian.PutUint32(image[36:], 1)
+	binary.BigEndian.PutUint64(image[40:], uint64(clusterSize))
+	binary.BigEndian.PutUint32(image[100:], 112)
+	image[104] = compressionType
+
+	binary.BigEndian.PutUint64(image[clusterSize:], uint64(2*clusterSize)|1<<63)
+	for index, cluster := range clusters {
+		data := bytes.Repeat([]byte{cluster.fill}, clusterSize)
+		hostOffset := uint64(len(image))
+
+		var entry uint64
+		switch cluster.kind {
+		case "data":
+			entry = hostOffset | 1<<63
+			image = append(image, data...)
+		case "zero":
+			entry = qcow2FlagZero
+		case "compressed":
+			compressed := compressCluster(t, compressionType, data)
+			if 100+len(compressed) > clusterSize {
+				t.Fatalf("compressed cluster %d takes %d bytes", index, len(compressed))
+			}
+			entry = qcow2FlagCompressed | (hostOffset + 100)
+			host := make([]byte, clusterSize)
+			copy(host[100:], compressed)
+			image = append(image, host...)
+		}
+		binary.BigEndian.PutUint64(image[2*clusterSize+8*index:], entry)
+	}
+	return image
+}
+
+func openTestQcow2(image []byte, openBacking func(string) (Image, error)) (*Qcow2, error) {
+	return openQcow2(bytes.NewReader(image), int64(len(image)), openBacking)
+}
+
+func compressCluster(t *testing.T, compressionType byte, data []byte) []byte {
+	t.Helper()
+	if compressionType == qcow2CompressionZstd {
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer encoder.Close()
+		return encoder.EncodeAll(data, nil)
+	}
+
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return compressed.Bytes()
+}
+
+func TestQcow2ReadAt(t *testing.T) {
+	clusters := []testCluster{
+		{kind: "data", fill: 'a'},
+		{},
+		{kind: "zero"},
+		{kind: "compressed", fill: 'c'},
+		{},
+	}
+	backingClusters := []testCluster{
+		{kind: "data", fill: 'x'},
+		{kind: "data", fill: 'b'},
+		{kind: "data", fill: 'x'},
+		{kind: "data", fill: 'x'},
+	}
+	// the raw backing file is a single grain spanning every cluster
+	rawBacking := bytes.Repeat([]byte{'r'}, 5<<testQcow2ClusterBits)
+
+	tests := []struct {
+		name            string
+		compressionType byte
+		backingFile     string
+		want            string
+		wantGrains      []Grain
+	}{
+		{
+			name:       "deflate",
+			want:       "a\x00\x00c\x00",
+			wantGrains: []Grain{{Offset: 0, Length: 512, StoredSize: 512}, {Offset: 1536, Length: 512, StoredSize: 412}},
+		},
+		{
+			name:            "zstd",
+			compressionType: qcow2CompressionZstd,
+			want:            "a\x00\x00c\x00",
+			wantGrains:      []Grain{{Offset: 0, Length: 512, StoredSize: 512}, {Offset: 1536, Length: 512, StoredSize: 412}},
+		},
+		{
+			// the zero cluster hides the backing file, the last cluster is
+			// beyond the end of the backing file
+			name:        "backing file",
+			backingFile: "base.qcow2",
+			want:        "ab\x00c\x00",
+			wantGrains: []Grain{
+				{Offset: 0, Length: 512, StoredSize: 512},
+				{Offset: 512, Length: 512, StoredSize: 512},
+				{Offset: 1536, Length: 512, StoredSize: 412},
+			},
+		},
+		{
+			// only the parts of the raw grain the overlay doesn't override
+			// are stored in the backing file
+			name:        "raw backing file",
+			backingFile: "base.raw",
+			want:        "ar\x00cr",
+			wantGrains: []Grain{
+				{Offset: 0, Length: 512, StoredSize: 512},
+				{Offset: 512, Length: 512, StoredSize: 512},
+				{Offset: 1536, Length: 512, StoredSize: 412},
+				{Offset: 2048, Length: 512, StoredSize: 512},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			image := makeQcow2(t, test.compressionType, test.backingFile, clusters)
+
+			q, err := openTestQcow2(image, func(name string) (Image, error) {
+				switch name {
+				case "base.qcow2":
+					return openTestQcow2(makeQcow2(t, 0, "", backingClusters), nil)
+				case "base.raw":
+					return openRaw(bytes.NewReader(rawBacking), int64(len(rawBacking))), nil
+				}
+				return nil, fmt.Errorf("unexpected backing file %q", name)
+			})
+			if err != nil {
+				t.Fatalf("openQcow2() error = %v", err)
+			}
+			if q.Size() != int64(len(clusters))<<testQcow2ClusterBits {
+				t.Errorf("Size() = %d, want %d", q.Size(), len(clusters)<<testQcow2ClusterBits)
+			}
+
+			data := make([]byte, q.Size())
+			if n, err := q.ReadAt(data, 0); err != nil || n != len(data) {
+				t.Fatalf("ReadAt() = %d, %v, want %d, nil", n, err, len(data))
+			}
+			var got []byte
+			for offset := 0; offset < len(data); offset += 1 << testQcow2ClusterBits {
+				cluster := data[offset : offset+1<<testQcow2ClusterBits]
+				if !bytes.Equal(cluster, bytes.Repeat(cluster[:1], len(cluster))) {
+					t.Fatalf("cluster at %d is not filled with a single byte", offset)
+				}
+				got = append(got, cluster[0])
+			}
+			if string(got) != test.want {
+				t.Errorf("ReadAt() clusters = %q, want %q", got, test.want)
+			}
+
+			if grains := q.Grains(); !reflect.DeepEqual(grains, test.wantGrains) {
+				t.Errorf("Grains() = %v, want %v", grains, test.wantGrains)
+			}
+		})
+	}
+}
+
+func TestQcow2ReadAtAcrossClusters(t *testing.T) {
+	image := makeQcow2(t, 0, "", []testCluster{{kind: "data", fill: 'a'}, {kind: "data", fill: 'b'}})
+	q, err := openTestQcow2(image, nil)
+	if err != nil {
+		t.Fatalf("openQcow2() error = %v", err)
+	}
+
+	data := make([]byte, 4)
+	if n, err := q.ReadAt(data, 510); err != nil || string(data[:n]) != "aabb" {
+		t.Errorf("ReadAt(510) = %q, %v, want %q, nil", data[:n], err, "aabb")
+	}
+	// reads stop at the end of the disk
+	if n, err := q.ReadAt(data, 1022); err == nil || string(data[:n]) != "bb" {
+		t.Errorf("ReadAt(1022) = %q, %v, want %q, EOF", data[:n], err, "bb")
+	}
+}
+
+func TestQcow2BackingFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		image []byte
+		want  string
+	}{
+		{name: "no backing file", image: makeQcow2(t, 0, "", nil), want: ""},
+		{name: "backing file", image: makeQcow2(t, 0, "../base.qcow2", nil), want: "../base.qcow2"},
+		{name: "not qcow2", image: []byte("KDMV\x01\x00\x00\x00"), want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := qcow2BackingFile(bytes.NewReader(test.image))
+			if err != nil {
+				t.Fatalf("qcow2BackingFile() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("qcow2BackingFile() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestOpenQcow2Unsupported(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(header []byte)
+	}{
+		{name: "cluster bits", modify: func(header []byte) { binary.BigEndian.PutUint32(header[20:], 8) }},
+		{name: "encrypted", modify: func(header []byte) { binary.BigEndian.PutUint32(header[32:], 1) }},
+		{name: "extended L2", modify: func(header []byte) { binary.BigEndian.PutUint64(header[72:], qcow2IncompatExtendedL2) }},
+		{name: "L1 table beyond the file", modify: func(header []byte) { binary.BigEndian.PutUint32(header[36:], 1<<30) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			image := makeQcow2(t, 0, "", []testCluster{{kind: "data", fill: 'a'}})
+			test.modify(image)
+			if _, err := openTestQcow2(image, nil); err == nil {
+				t.Errorf("openQcow2() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package disk
+
+import (
+	"io"
+)
+
+const rawGrainSize = 64 * 1024
+
+// Raw is a plain disk image: the file content is the disk content and every
+// byte of it is stored.
+type Raw struct {
+	r    io.ReaderAt
+	size int64
+}
+
+func openRaw(r io.ReaderAt, size int64) *Raw {
+	return &Raw{r: r, size: size}
+}
+
+func (r *Raw) Format() string {
+	return "raw"
+}
+
+func (r *Raw) Size() int64 {
+	return r.size
+}
+
+func (r *Raw) Grains() []Grain {
+	grains := make([]Grain, 0, r.size/rawGrainSize+1)
+	for offset := int64(0); offset < r.size; offset += rawGrainSize {
+		length := min(rawGrainSize, r.size-offset)
+		grains = append(grains, Grain{Offset: offset, Length: length, StoredSize: length})
+	}
+	return grains
+}
+
+func (r *Raw) ReadAt(p []byte, off int64) (int, error) {
+	return r.r.ReadAt(p, off)
+}
@@ -0,0 +1,202 @@
+package disk
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const GuestRootFsDir = "temp/guest-rootfs"
+
+var virtualGuestPaths = []string{"/proc", "/sys", "/dev", "/run", "/tmp"}
+
+// container image stores are skipped as the images in them are analyzed on
+// their own, not as part of the guest OS
+var imageStorePaths = []string{"/var/lib/containerd", "/var/lib/docker", "/var/lib/containers", "/var/lib/rancher"}
+
+type GuestRootFs struct {
+	Disk        string
+	Format      string
+	Partition   Partition
+	Dir         string
+	ImageStores map[string]int64
+	// Hardlinks map every extracted hardlink to the first path of its inode,
+	// both absolute in the guest, so the inode is only counted once
+	Hardlinks map[string]string
+}
+
+// ExtractGuestRootFs copies the root filesystem of every bundle disk that holds
+// an operating system into a directory, so it can be catalogued like an image.
+func ExtractGuestRootFs(bundlePath string) ([]GuestRootFs, error) {
+	fmt.Println("Started extracting guest root filesystems...")
+
+	bundle, err := OpenBundle(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	defer bundle.Close()
+
+	disks, err := bundle.Disks()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.RemoveAll(GuestRootFsDir); err != nil {
+		return nil, fmt.Errorf("error removing directory %s: %w", GuestRootFsDir, err)
+	}
+
+	var rootFilesystems []GuestRootFs
+	for _, entry := range disks {
+		img, err := bundle.OpenImage(entry)
+		if err != nil {
+			return nil, fmt.Errorf("error opening disk %s: %w", entry.Name, err)
+		}
+
+		partitions, err := ReadPartitions(img)
+		if err != nil {
+			return nil, fmt.Errorf("error reading partitions of disk %s: %w", entry.Name, err)
+		}
+
+		for _, partition := range partitions {
+			partitionReader := io.NewSectionReader(img, partition.Offset, partition.Size)
+			if !IsExt4(partitionReader) {
+				continue
+			}
+
+			fs, err := OpenExt4(partitionReader)
+			if err != nil {
+				return nil, fmt.Errorf("error opening filesystem of disk %s partition %d: %w", entry.Name, partition.Index, err)
+			}
+
+			if _, err := fs.Lookup("/etc/os-release"); err != nil {
+				continue
+			}
+
+			diskName := strings.TrimSuffix(filepath.Base(entry.Name), filepath.Ext(entry.Name))
+			dest := filepath.Join(GuestRootFsDir, fmt.Sprintf("guest-%s-p%d", diskName, partition.Index))
+			fmt.Printf("Extracting guest root filesystem of disk %s partition %d\n", entry.Name, partition.Index)
+
+			imageStores, hardlinks, err := extractExt4(fs, dest)
+			if err != nil {
+				return nil, fmt.Errorf("error extracting filesystem of disk %s partition %d: %w", entry.Name, partition.Index, err)
+			}
+
+			rootFilesystems = append(rootFilesystems, GuestRootFs{
+				Disk:        entry.Name,
+				Format:      img.Format(),
+				Partition:   partition,
+				Dir:         dest,
+				ImageStores: imageStores,
+				Hardlinks:   hardlinks,
+			})
+		}
+	}
+
+	fmt.Println("Finished extracting guest root filesystems successfully.")
+	return rootFilesystems, nil
+}
+
+// extractExt4 copies the filesystem to dest and returns the size of each
+// container image store found on it, and the hardlinks it extracted.
+// Every entry is created exclusively in a directory created by the walk, so
+// an entry reusing the name of a symlink fails instead of following it out
+// of dest.
+func extractExt4(fs *Ext4, dest string) (map[string]int64, map[string]string, error) {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, nil, fmt.Errorf("error creating directory %s: %w", dest, err)
+	}
+
+	// hardlinked inodes are extracted once and linked afterwards
+	extracted := map[int64]string{}
+	hardlinks := map[string]string{}
+	imageStores := map[string]int64{}
+
+	err := fs.Walk(func(filePath string, inode *Inode) (bool, error) {
+		for _, virtualPath := range virtualGuestPaths {
+			if filePath == virtualPath {
+				return true, nil
+			}
+		}
+		for _, imageStorePath := range imageStorePaths {
+			if filePath == imageStorePath && inode.IsDir() {
+				size, err := fs.TreeSize(filePath, inode)
+				if err != nil {
+					return false, fmt.Errorf("error measuring image store %s: %w", filePath, err)
+				}
+				imageStores[filePath] = size
+				return true, nil
+			}
+		}
+
+		target := filepath.Join(dest, filePath)
+		switch {
+		case inode.IsDir():
+			if err := os.Mkdir(target, os.FileMode(inode.Mode&0777|0700)); err != nil {
+				return false, fmt.Errorf("error creating directory %s: %w", target, err)
+			}
+		case inode.IsSymlink():
+			linkTarget, err := fs.ReadFile(inode)
+			if err != nil {
+				return false, fmt.Errorf("error reading symlink %s: %w", filePath, err)
+			}
+			if err := os.Symlink(guestSymlinkTarget(filePath, string(linkTarget)), target); err != nil {
+				return false, fmt.Errorf("error creating symlink %s: %w", target, err)
+			}
+		case inode.IsRegular():
+			if existing, ok := extracted[inode.Number]; ok {
+				if err := os.Link(filepath.Join(dest, existing), target); err != nil {
+					return false, fmt.Errorf("error creating hardlink %s: %w", target, err)
+				}
+				hardlinks[filePath] = existing
+				return false, nil
+			}
+
+			if err := extractExt4File(fs, inode, target); err != nil {
+				return false, err
+			}
+			if inode.Links > 1 {
+				extracted[inode.Number] = filePath
+			}
+		}
+
+		return false, nil
+	})
+
+	return imageStores, hardlinks, err
+}
+
+// guestSymlinkTarget makes the target of a guest symlink relative to the
+// link, so the extracted link resolves inside the extracted root: absolute
+// targets and ".." past the root are relative to the guest root.
+func guestSymlinkTarget(linkPath, target string) string {
+	if !path.IsAbs(target) {
+		target = path.Join(path.Dir(linkPath), target)
+	}
+	relative, err := filepath.Rel(path.Dir(linkPath), path.Clean(target))
+	if err != nil {
+		return "."
+	}
+	return relative
+}
+
+func extractExt4File(fs *Ext4, inode *Inode, target string) error {
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.FileMode(inode.Mode&0777|0400))
+	if err != nil {
+		return fmt.Errorf("error creating file %s: %w", target, err)
+	}
+	defer file.Close()
+
+	if err := fs.CopyFile(inode, file); err != nil {
+		return fmt.Errorf("error writing file %s: %w", target, err)
+	}
+
+	// keeps sparse files sparse and sizes exact when the last block is a hole
+	if err := file.Truncate(inode.Size); err != nil {
+		return fmt.Errorf("error truncating file %s: %w", target, err)
+	}
+
+	return nil
+}
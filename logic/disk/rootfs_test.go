@@ -0,0 +1,199 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExtractExt4RecordsHardlinks(t *testing.T) {
+	source := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(source, "usr/bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "usr/bin/busybox"), make([]byte, 4096), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{"usr/bin/sh", "usr/bin/vi"} {
+		if err := os.Link(filepath.Join(source, "usr/bin/busybox"), filepath.Join(source, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs := makeExt4(t, "-d", source)
+	dest := filepath.Join(t.TempDir(), "rootfs")
+	_, hardlinks, err := extractExt4(fs, dest)
+	if err != nil {
+		t.Fatalf("extractExt4() error = %v", err)
+	}
+
+	// the first path of the inode in walk order is extracted, the others link to it
+	var first string
+	for _, candidate := range []string{"/usr/bin/busybox", "/usr/bin/sh", "/usr/bin/vi"} {
+		if _, ok := hardlinks[candidate]; !ok {
+			first = candidate
+			break
+		}
+	}
+	want := map[string]string{}
+	for _, candidate := range []string{"/usr/bin/busybox", "/usr/bin/sh", "/usr/bin/vi"} {
+		if candidate != first {
+			want[candidate] = first
+		}
+	}
+	if !reflect.DeepEqual(hardlinks, want) {
+		t.Errorf("extractExt4() hardlinks = %v, want %v", hardlinks, want)
+	}
+
+	firstInfo, err := os.Stat(filepath.Join(dest, first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for link := range hardlinks {
+		linkInfo, err := os.Stat(filepath.Join(dest, link))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(firstInfo, linkInfo) {
+			t.Errorf("%s isn't a hardlink to %s", link, first)
+		}
+	}
+}
+
+func TestGuestSymlinkTarget(t *testing.T) {
+	tests := []struct {
+		linkPath string
+		target   string
+		want     string
+	}{
+		{linkPath: "/bin", target: "usr/bin", want: "usr/bin"},
+		{linkPath: "/bin/sh", target: "bash", want: "bash"},
+		{linkPath: "/usr/bin/sh", target: "/bin/bash", want: "../../bin/bash"},
+		{linkPath: "/etc/localtime", target: "/usr/share/zoneinfo/UTC", want: "../usr/share/zoneinfo/UTC"},
+		{linkPath: "/etc/escape", target: "../../../../etc/shadow", want: "shadow"},
+		{linkPath: "/root", target: "/", want: "."},
+	}
+	for _, test := range tests {
+		if got := guestSymlinkTarget(test.linkPath, test.target); got != test.want {
+			t.Errorf("guestSymlinkTarget(%q, %q) = %q, want %q", test.linkPath, test.target, got, test.want)
+		}
+	}
+}
+
+// patchDirEntry edits the directory entry named name in an ext4 image, the
+// name is looked up in the raw bytes so it must be unique in the image.
+func patchDirEntry(t *testing.T, imagePath, name string, patch func(entry []byte)) {
+	t.Helper()
+	image, err := os.ReadFile(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(image, []byte(name)) != 1 {
+		t.Fatalf("%s is not unique in the image", name)
+	}
+	patch(image[bytes.Index(image, []byte(name))-8:])
+	if err := os.WriteFile(imagePath, image, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// openExt4Image opens the ext4 image at imagePath for the time of the test.
+func openExt4Image(t *testing.T, imagePath string) *Ext4 {
+	t.Helper()
+	image, err := os.Open(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { image.Close() })
+	fs, err := OpenExt4(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestExtractExt4RejectsNamesWithPaths(t *testing.T) {
+	source := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(source, "etc/patchme1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	imagePath := makeExt4Image(t, "-d", source)
+	// the entry would extract to ../../etc/passwd
+	patchDirEntry(t, imagePath, "patchme1", func(entry []byte) { copy(entry[8:], "../../..") })
+
+	dest := filepath.Join(t.TempDir(), "rootfs")
+	if _, _, err := extractExt4(openExt4Image(t, imagePath), dest); err == nil {
+		t.Errorf("extractExt4() error = nil, want an error")
+	}
+}
+
+func TestExt4WalkDetectsDirectoryCycles(t *testing.T) {
+	source := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(source, "etc/patchme1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	imagePath := makeExt4Image(t, "-d", source)
+	// the directory entry points back to the root directory
+	patchDirEntry(t, imagePath, "patchme1", func(entry []byte) { binary.LittleEndian.PutUint32(entry, ext4RootInode) })
+
+	visits := 0
+	err := openExt4Image(t, imagePath).Walk(func(string, *Inode) (bool, error) {
+		if visits++; visits > 1000 {
+			return false, fmt.Errorf("walked %d entries", visits)
+		}
+		return false, nil
+	})
+	if err == nil || visits > 1000 {
+		t.Errorf("Walk() error = %v after %d entries, want a cycle error", err, visits)
+	}
+}
+
+func TestExtractExt4DuplicateNameDoesNotFollowSymlink(t *testing.T) {
+	source := t.TempDir()
+	outside := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(source, "etc/linknam1/aaaaaaaa"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(source, "etc/linknam2")); err != nil {
+		t.Fatal(err)
+	}
+	imagePath := makeExt4Image(t, "-d", source)
+
+	// both entries of /etc are renamed linkname, the first one in directory
+	// order becomes the symlink and the second one the directory
+	fs := openExt4Image(t, imagePath)
+	dir, err := fs.Lookup("/etc/linknam1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	symlink, err := fs.Lookup("/etc/linknam2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	etc, err := fs.Lookup("/etc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := fs.ReadDir(etc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, inode := range []*Inode{symlink, dir} {
+		patchDirEntry(t, imagePath, entries[i].Name, func(entry []byte) {
+			binary.LittleEndian.PutUint32(entry, uint32(inode.Number))
+			copy(entry[8:], "linkname")
+		})
+	}
+
+	dest := filepath.Join(t.TempDir(), "rootfs")
+	if _, _, err := extractExt4(openExt4Image(t, imagePath), dest); err == nil {
+		t.Errorf("extractExt4() error = nil, want an error")
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("extractExt4() wrote %d entries outside of its destination", len(entries))
+	}
+}
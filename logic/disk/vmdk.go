@@ -0,0 +1,260 @@
+package disk
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+const (
+	sectorSize = 512
+
+	vmdkMagic = "KDMV"
+
+	vmdkFlagCompressed = 1 << 16
+	vmdkFlagMarkers    = 1 << 17
+
+	vmdkMarkerEOS = 0
+
+	vmdkGdAtEnd = 0xffffffffffffffff
+)
+
+type vmdkHeader struct {
+	MagicNumber        uint32
+	Version            uint32
+	Flags              uint32
+	Capacity           uint64
+	GrainSize          uint64
+	DescriptorOffset   uint64
+	DescriptorSize     uint64
+	NumGTEsPerGT       uint32
+	RgdOffset          uint64
+	GdOffset           uint64
+	OverHead           uint64
+	UncleanShutdown    byte
+	SingleEndLineChar  byte
+	NonEndLineChar     byte
+	DoubleEndLineChar1 byte
+	DoubleEndLineChar2 byte
+	CompressAlgorithm  uint16
+}
+
+type vmdkGrain struct {
+	dataOffset int64
+	storedSize int64
+	compressed bool
+}
+
+type Vmdk struct {
+	r          io.ReaderAt
+	fileSize   int64
+	header     vmdkHeader
+	grainBytes int64
+	grains     map[int64]vmdkGrain
+
+	mu          sync.Mutex
+	cachedIndex int64
+	cachedGrain []byte
+}
+
+func openVmdk(r io.ReaderAt, fileSize int64) (*Vmdk, error) {
+	v := &Vmdk{r: r, fileSize: fileSize, grains: map[int64]vmdkGrain{}, cachedIndex: -1}
+
+	if err := binary.Read(io.NewSectionReader(r, 0, sectorSize), binary.LittleEndian, &v.header); err != nil {
+		return nil, fmt.Errorf("error reading vmdk header: %w", err)
+	}
+	if v.header.GrainSize == 0 {
+		return nil, fmt.Errorf("invalid vmdk grain size")
+	}
+	v.grainBytes = int64(v.header.GrainSize) * sectorSize
+
+	var err error
+	if v.header.Flags&vmdkFlagMarkers != 0 {
+		err = v.scanMarkers()
+	} else {
+		err = v.readGrainDirectory()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// scanMarkers walks a streamOptimized extent from start to end. Every grain is
+// preceded by a marker holding its LBA and compressed size, so the grain
+// tables stored at the end of the file are not needed.
+func (v *Vmdk) scanMarkers() error {
+	marker := make([]byte, 16)
+	pos := int64(v.header.OverHead) * sectorSize
+
+	for pos+16 <= v.fileSize {
+		if _, err := v.r.ReadAt(marker, pos); err != nil {
+			return fmt.Errorf("error reading vmdk marker at %d: %w", pos, err)
+		}
+
+		value := binary.LittleEndian.Uint64(marker[0:8])
+		size := int64(binary.LittleEndian.Uint32(marker[8:12]))
+		markerType := binary.LittleEndian.Uint32(marker[12:16])
+
+		if size > 0 {
+			v.grains[int64(value)/int64(v.header.GrainSize)] = vmdkGrain{
+				dataOffset: pos + 12,
+				storedSize: roundUp(12+size, sectorSize),
+				compressed: true,
+			}
+			pos += roundUp(12+size, sectorSize)
+			continue
+		}
+
+		if markerType == vmdkMarkerEOS {
+			break
+		}
+
+		// metadata marker: the value holds the number of metadata sectors
+		pos += sectorSize + int64(value)*sectorSize
+	}
+
+	return nil
+}
+
+func (v *Vmdk) readGrainDirectory() error {
+	if v.header.GdOffset == vmdkGdAtEnd || v.header.NumGTEsPerGT == 0 {
+		return fmt.Errorf("unsupported vmdk layout: grain directory not found")
+	}
+
+	totalGrains := int64(divRoundUp(v.header.Capacity, v.header.GrainSize))
+	gtCount := divRoundUp(uint64(totalGrains), uint64(v.header.NumGTEsPerGT))
+
+	gd := make([]uint32, gtCount)
+	if err := binary.Read(io.NewSectionReader(v.r, int64(v.header.GdOffset)*sectorSize, int64(gtCount)*4), binary.LittleEndian, gd); err != nil {
+		return fmt.Errorf("error reading vmdk grain directory: %w", err)
+	}
+
+	compressed := v.header.Flags&vmdkFlagCompressed != 0
+	gt := make([]uint32, v.header.NumGTEsPerGT)
+	for gdIndex, gtSector := range gd {
+		if gtSector == 0 {
+			continue
+		}
+		if err := binary.Read(io.NewSectionReader(v.r, int64(gtSector)*sectorSize, int64(len(gt))*4), binary.LittleEndian, gt); err != nil {
+			return fmt.Errorf("error reading vmdk grain table %d: %w", gdIndex, err)
+		}
+
+		for gtIndex, grainSector := range gt {
+			// 0 is an unallocated grain and 1 a grain explicitly marked as zero
+			if grainSector <= 1 {
+				continue
+			}
+
+			index := int64(gdIndex)*int64(v.header.NumGTEsPerGT) + int64(gtIndex)
+			grain := vmdkGrain{dataOffset: int64(grainSector) * sectorSize, storedSize: v.grainBytes}
+			if compressed {
+				sizeField := make([]byte, 4)
+				if _, err := v.r.ReadAt(sizeField, grain.dataOffset+8); err != nil {
+					return fmt.Errorf("error reading vmdk grain %d: %w", index, err)
+				}
+				grain.dataOffset += 12
+				grain.storedSize = roundUp(12+int64(binary.LittleEndian.Uint32(sizeField)), sectorSize)
+				grain.compressed = true
+			}
+			v.grains[index] = grain
+		}
+	}
+
+	return nil
+}
+
+func (v *Vmdk) Format() string {
+	return "vmdk"
+}
+
+func (v *Vmdk) Size() int64 {
+	return int64(v.header.Capacity) * sectorSize
+}
+
+func (v *Vmdk) Grains() []Grain {
+	grains := make([]Grain, 0, len(v.grains))
+	for index, grain := range v.grains {
+		grains = append(grains, Grain{Offset: index * v.grainBytes, Length: v.grainBytes, StoredSize: grain.storedSize})
+	}
+
+	sort.Slice(grains, func(i, j int) bool {
+		return grains[i].Offset < grains[j].Offset
+	})
+	return grains
+}
+
+func (v *Vmdk) ReadAt(p []byte, off int64) (int, error) {
+	if off >= v.Size() {
+		return 0, io.EOF
+	}
+
+	read := 0
+	for read < len(p) && off < v.Size() {
+		index := off / v.grainBytes
+		inGrain := off % v.grainBytes
+
+		data, err := v.readGrain(index)
+		if err != nil {
+			return read, err
+		}
+
+		n := copy(p[read:], data[inGrain:])
+		read += n
+		off += int64(n)
+	}
+
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+func (v *Vmdk) readGrain(index int64) ([]byte, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.cachedIndex == index {
+		return v.cachedGrain, nil
+	}
+
+	data := make([]byte, v.grainBytes)
+	grain, ok := v.grains[index]
+	switch {
+	case !ok:
+		// unallocated grains read as zeroes
+	case grain.compressed:
+		compressed := make([]byte, grain.storedSize-12)
+		if _, err := v.r.ReadAt(compressed, grain.dataOffset); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading vmdk grain %d: %w", index, err)
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing vmdk grain %d: %w", index, err)
+		}
+		if _, err := io.ReadFull(zr, data); err != nil && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("error decompressing vmdk grain %d: %w", index, err)
+		}
+	default:
+		if _, err := v.r.ReadAt(data, grain.dataOffset); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading vmdk grain %d: %w", index, err)
+		}
+	}
+
+	v.cachedIndex = index
+	v.cachedGrain = data
+	return data, nil
+}
+
+func roundUp(value, multiple int64) int64 {
+	return (value + multiple - 1) / multiple * multiple
+}
+
+func divRoundUp(value, divisor uint64) uint64 {
+	return (value + divisor - 1) / divisor
+}
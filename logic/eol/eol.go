@@ -0,0 +1,118 @@
+package eol
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// UserDatasetPath is read instead of the embedded dataset when it exists in
+// the working directory, so end-of-life dates can be updated without a new
+// release. It has the same format as dataset.json.
+const UserDatasetPath = "eol.json"
+
+// soonDays is how close to its end of life a release is reported as ending soon.
+const soonDays = 180
+
+//go:embed dataset.json
+var embeddedDataset []byte
+
+type Dataset struct {
+	Products []Product `json:"products"`
+}
+
+// Product is a distro or a runtime, matched by os-release ID for distros and
+// by runtime name for runtimes.
+type Product struct {
+	Name   string   `json:"name"`
+	Match  []string `json:"match"`
+	Cycles []Cycle  `json:"cycles"`
+}
+
+type Cycle struct {
+	Cycle string `json:"cycle"`
+	EOL   string `json:"eol"`
+}
+
+type Status struct {
+	Product string
+	Cycle   string
+	// EOL is the zero time when the release is unknown to the dataset
+	EOL time.Time
+}
+
+func Load() (*Dataset, error) {
+	data := embeddedDataset
+	if userData, err := os.ReadFile(UserDatasetPath); err == nil {
+		fmt.Println("Using end-of-life dataset:", UserDatasetPath)
+		data = userData
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading %s: %w", UserDatasetPath, err)
+	}
+
+	var dataset Dataset
+	if err := json.Unmarshal(data, &dataset); err != nil {
+		return nil, fmt.Errorf("unable to unmarshall end-of-life dataset: %w", err)
+	}
+	return &dataset, nil
+}
+
+// Lookup finds the release cycle of a distro ID or runtime name, a version
+// belongs to a cycle when it is the cycle or one of its point releases, e.g.
+// 3.19.1 is in 3.19 and 17.0.9 is in 17.
+func (dataset *Dataset) Lookup(match, version string) Status {
+	for _, product := range dataset.Products {
+		if !contains(product.Match, match) {
+			continue
+		}
+
+		for _, cycle := range product.Cycles {
+			if version != cycle.Cycle && !strings.HasPrefix(version, cycle.Cycle+".") {
+				continue
+			}
+
+			eol, err := time.Parse(time.DateOnly, cycle.EOL)
+			if err != nil {
+				fmt.Printf("Warn: invalid end-of-life date %s for %s %s\n", cycle.EOL, product.Name, cycle.Cycle)
+				return Status{Product: product.Name, Cycle: cycle.Cycle}
+			}
+			return Status{Product: product.Name, Cycle: cycle.Cycle, EOL: eol}
+		}
+		return Status{Product: product.Name}
+	}
+	return Status{}
+}
+
+func (status Status) Known() bool {
+	return !status.EOL.IsZero()
+}
+
+func (status Status) IsEOL(now time.Time) bool {
+	return status.Known() && !now.Before(status.EOL)
+}
+
+// Describe is the support status of the release at the given time.
+func (status Status) Describe(now time.Time) string {
+	switch {
+	case !status.Known():
+		return "unknown"
+	case status.IsEOL(now):
+		return "end of life since " + status.EOL.Format(time.DateOnly)
+	case status.EOL.Sub(now) < soonDays*24*time.Hour:
+		return "end of life soon, on " + status.EOL.Format(time.DateOnly)
+	default:
+		return "supported until " + status.EOL.Format(time.DateOnly)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
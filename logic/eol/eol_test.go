@@ -0,0 +1,111 @@
+package eol
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+var testDataset = &Dataset{Products: []Product{
+	{Name: "Alpine Linux", Match: []string{"alpine"}, Cycles: []Cycle{
+		{Cycle: "3.1", EOL: "2016-05-01"},
+		{Cycle: "3.19", EOL: "2025-11-01"},
+	}},
+	{Name: "Java", Match: []string{"java", "openjdk"}, Cycles: []Cycle{
+		{Cycle: "17", EOL: "2029-09-30"},
+		{Cycle: "21", EOL: "not a date"},
+	}},
+}}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		match   string
+		version string
+		want    Status
+	}{
+		{match: "alpine", version: "3.19", want: Status{Product: "Alpine Linux", Cycle: "3.19", EOL: date(2025, 11, 1)}},
+		{match: "alpine", version: "3.19.1", want: Status{Product: "Alpine Linux", Cycle: "3.19", EOL: date(2025, 11, 1)}},
+		// 3.1 is not a prefix of 3.19
+		{match: "alpine", version: "3.1.4", want: Status{Product: "Alpine Linux", Cycle: "3.1", EOL: date(2016, 5, 1)}},
+		{match: "openjdk", version: "17.0.9", want: Status{Product: "Java", Cycle: "17", EOL: date(2029, 9, 30)}},
+		{match: "alpine", version: "3.20.0", want: Status{Product: "Alpine Linux"}},
+		{match: "java", version: "21.0.1", want: Status{Product: "Java", Cycle: "21"}},
+		{match: "debian", version: "12", want: Status{}},
+	}
+	for _, test := range tests {
+		if got := testDataset.Lookup(test.match, test.version); got != test.want {
+			t.Errorf("Lookup(%q, %q) = %+v, want %+v", test.match, test.version, got, test.want)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	now := date(2025, 6, 1)
+	tests := []struct {
+		status Status
+		want   string
+	}{
+		{status: Status{Product: "Alpine Linux"}, want: "unknown"},
+		{status: Status{EOL: date(2016, 5, 1)}, want: "end of life since 2016-05-01"},
+		{status: Status{EOL: now}, want: "end of life since 2025-06-01"},
+		{status: Status{EOL: date(2025, 11, 1)}, want: "end of life soon, on 2025-11-01"},
+		{status: Status{EOL: date(2029, 9, 30)}, want: "supported until 2029-09-30"},
+	}
+	for _, test := range tests {
+		if got := test.status.Describe(now); got != test.want {
+			t.Errorf("Describe(%v) = %q, want %q", test.status.EOL, got, test.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name        string
+		userDataset string
+		wantProduct string
+		wantErr     bool
+	}{
+		{name: "embedded", wantProduct: "Alpine Linux"},
+		{name: "user dataset", userDataset: `{"products": [{"name": "Custom", "match": ["custom"]}]}`, wantProduct: "Custom"},
+		{name: "invalid user dataset", userDataset: `{"products": [`, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chdir(t, t.TempDir())
+			if test.userDataset != "" {
+				if err := os.WriteFile(UserDatasetPath, []byte(test.userDataset), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			dataset, err := Load()
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Load() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error: %v", err)
+			}
+			if len(dataset.Products) == 0 || dataset.Products[0].Name != test.wantProduct {
+				t.Errorf("Load() products = %+v, want %s first", dataset.Products, test.wantProduct)
+			}
+		})
+	}
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func chdir(t *testing.T, dir string) {
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(oldDir) })
+}
@@ -0,0 +1,384 @@
+package ociimage
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/klauspost/compress/zstd"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	zarfPackageConfig     = "zarf.yaml"
+	zarfImagesDir         = multiArchiveExtractedDir + "/images"
+	zarfImageIndexPath    = zarfImagesDir + "/index.json"
+	dockerArchiveManifest = "manifest.json"
+	ociImageIndex         = "index.json"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ImageSources maps every individual archive to the Zarf component or the
+// image bundle it was unpacked from.
+var ImageSources = map[string]string{}
+
+type zarfPackage struct {
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Components []struct {
+		Name   string   `yaml:"name"`
+		Images []string `yaml:"images"`
+	} `yaml:"components"`
+}
+
+type dockerArchiveEntry struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+}
+
+// TransformAndCopyImageBundle detects the layout of an air-gapped image bundle
+// and copies each of its images to an individual docker archive. Supported
+// bundles are the gzip OCI multi-archive, Zarf packages and RKE2/k3s
+// `*-images.tar.zst` docker archives, compressed with gzip, zstd or not at all.
+func TransformAndCopyImageBundle(bundlePath string) error {
+	CompressedMultiArchive = path.Base(bundlePath)
+	MultiArchive = tempDir + "/" + CompressedMultiArchive
+
+	file, err := os.Open(bundlePath)
+	if err != nil {
+		return fmt.Errorf("error opening bundle %s: %v", bundlePath, err)
+	}
+	defer file.Close()
+
+	if err := decompressBundle(file, MultiArchive); err != nil {
+		return fmt.Errorf("error decompressing bundle: %v", err)
+	}
+
+	entries, err := tarEntryNames(MultiArchive)
+	if err != nil {
+		return fmt.Errorf("error listing bundle: %v", err)
+	}
+
+	switch bundleLayout(entries) {
+	case zarfLayout:
+		fmt.Println("Detected Zarf package:", CompressedMultiArchive)
+		err = transformZarfPackage()
+	case ociLayout:
+		fmt.Println("Detected OCI multi-archive:", CompressedMultiArchive)
+		err = transformOciMultiArchive()
+	case dockerArchiveLayout:
+		fmt.Println("Detected docker archive image bundle:", CompressedMultiArchive)
+		err = transformDockerArchive()
+	default:
+		return fmt.Errorf("unknown image bundle layout in %s", CompressedMultiArchive)
+	}
+	if err != nil {
+		return fmt.Errorf("error copying images of %s to Docker images: %v", CompressedMultiArchive, err)
+	}
+
+	return nil
+}
+
+type layout int
+
+const (
+	unknownLayout layout = iota
+	zarfLayout
+	ociLayout
+	dockerArchiveLayout
+)
+
+// bundleLayout tells the layout of a bundle from its top level entries: a
+// Zarf package also holds an OCI layout, below its images directory.
+func bundleLayout(entries map[string]bool) layout {
+	switch {
+	case entries[zarfPackageConfig]:
+		return zarfLayout
+	case entries[ociImageIndex]:
+		return ociLayout
+	case entries[dockerArchiveManifest]:
+		return dockerArchiveLayout
+	default:
+		return unknownLayout
+	}
+}
+
+func decompressBundle(bundle io.Reader, tarFilePath string) error {
+	bufferedBundle := bufio.NewReader(bundle)
+	magic, err := bufferedBundle.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("error reading bundle header: %v", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		uncompressedStream, err := gzip.NewReader(bufferedBundle)
+		if err != nil {
+			return fmt.Errorf("error creating gzip reader: %v", err)
+		}
+		defer uncompressedStream.Close()
+		return writeTar(uncompressedStream, tarFilePath)
+	case bytes.HasPrefix(magic, zstdMagic):
+		uncompressedStream, err := zstd.NewReader(bufferedBundle)
+		if err != nil {
+			return fmt.Errorf("error creating zstd reader: %v", err)
+		}
+		defer uncompressedStream.Close()
+		return writeTar(uncompressedStream, tarFilePath)
+	default:
+		return writeTar(bufferedBundle, tarFilePath)
+	}
+}
+
+// tarEntryNames returns the cleaned names of the entries of a tar file.
+func tarEntryNames(tarFilePath string) (map[string]bool, error) {
+	tarFile, err := os.Open(tarFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening tar file: %v", err)
+	}
+	defer tarFile.Close()
+
+	names := map[string]bool{}
+	tarReader := tar.NewReader(tarFile)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading tar entry: %v", err)
+		}
+		names[path.Clean(header.Name)] = true
+	}
+}
+
+func readTarEntry(tarFilePath, name string) ([]byte, error) {
+	tarFile, err := os.Open(tarFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening tar file: %v", err)
+	}
+	defer tarFile.Close()
+
+	tarReader := tar.NewReader(tarFile)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in %s", name, tarFilePath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading tar entry: %v", err)
+		}
+		if path.Clean(header.Name) == name {
+			return io.ReadAll(tarReader)
+		}
+	}
+}
+
+func transformOciMultiArchive() error {
+	if err := extractTar(MultiArchive, multiArchiveExtractedDir); err != nil {
+		return fmt.Errorf("error extracting archive: %v", err)
+	}
+
+	indexContents, err := unmarshallIndex(ociImageIndexFilePath)
+	if err != nil {
+		return fmt.Errorf("error extracting index contents: %v", err)
+	}
+
+	if err := transformOciToDockerImageFormat(indexContents); err != nil {
+		return err
+	}
+
+	return setUnattributedImageSources(CompressedMultiArchive)
+}
+
+func transformZarfPackage() error {
+	if err := extractTar(MultiArchive, multiArchiveExtractedDir); err != nil {
+		return fmt.Errorf("error extracting package: %v", err)
+	}
+
+	packageConfig, err := os.ReadFile(filepath.Join(multiArchiveExtractedDir, zarfPackageConfig))
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", zarfPackageConfig, err)
+	}
+
+	var zarfConfig zarfPackage
+	if err := yaml.Unmarshal(packageConfig, &zarfConfig); err != nil {
+		return fmt.Errorf("unable to unmarshall %s: %v", zarfPackageConfig, err)
+	}
+
+	// an image can be listed by several components of the package
+	componentsByImage := map[string][]string{}
+	for _, component := range zarfConfig.Components {
+		for _, image := range component.Images {
+			componentsByImage[normalizeImageName(image)] = append(componentsByImage[normalizeImageName(image)], component.Name)
+		}
+	}
+
+	if _, err := os.Stat(zarfImageIndexPath); os.IsNotExist(err) {
+		fmt.Printf("Warn: Zarf package %s has no images\n", CompressedMultiArchive)
+		return nil
+	}
+
+	indexJson, err := os.ReadFile(zarfImageIndexPath)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %v", zarfImageIndexPath, err)
+	}
+
+	var imgIndex imgspecv1.Index
+	if err := json.Unmarshal(indexJson, &imgIndex); err != nil {
+		return fmt.Errorf("unable to unmarshall %s: %v", zarfImageIndexPath, err)
+	}
+
+	// Zarf only records the image reference in the base name annotation,
+	// the oci transport looks images up by ref name
+	for i, manifest := range imgIndex.Manifests {
+		if manifest.Annotations[imgspecv1.AnnotationRefName] == "" {
+			if manifest.Annotations == nil {
+				imgIndex.Manifests[i].Annotations = map[string]string{}
+			}
+			imgIndex.Manifests[i].Annotations[imgspecv1.AnnotationRefName] = manifest.Annotations[imgspecv1.AnnotationBaseImageName]
+		}
+	}
+
+	indexJson, err = json.Marshal(imgIndex)
+	if err != nil {
+		return fmt.Errorf("unable to marshall %s: %v", zarfImageIndexPath, err)
+	}
+	if err := os.WriteFile(zarfImageIndexPath, indexJson, 0644); err != nil {
+		return fmt.Errorf("unable to write %s: %v", zarfImageIndexPath, err)
+	}
+
+	var eg errgroup.Group
+	for _, manifest := range imgIndex.Manifests {
+		imageRef := manifest.Annotations[imgspecv1.AnnotationRefName]
+		if imageRef == "" {
+			fmt.Printf("Warn: skipping image %s without a reference in Zarf package %s\n", manifest.Digest, CompressedMultiArchive)
+			continue
+		}
+
+		source := fmt.Sprintf("%s (Zarf package %s)", CompressedMultiArchive, zarfConfig.Metadata.Name)
+		if components := componentsByImage[normalizeImageName(imageRef)]; len(components) == 1 {
+			source = fmt.Sprintf("%s component %s", source, components[0])
+		} else if len(components) > 1 {
+			source = fmt.Sprintf("%s components %s", source, strings.Join(components, ", "))
+		}
+
+		archive := addImageSource(archiveNameForImage(imageRef, manifest.Digest.String()), manifest.Digest.String(), source)
+
+		eg.Go(func() error {
+			if err := imageCopy("oci:"+zarfImagesDir+":"+imageRef, "docker-archive:"+archive); err != nil {
+				return err
+			}
+			return recordLayerBlobs(zarfImagesDir, manifest.Digest.String(), archive)
+		})
+	}
+
+	return eg.Wait()
+}
+
+func transformDockerArchive() error {
+	manifestJson, err := readTarEntry(MultiArchive, dockerArchiveManifest)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", dockerArchiveManifest, err)
+	}
+
+	var entries []dockerArchiveEntry
+	if err := json.Unmarshal(manifestJson, &entries); err != nil {
+		return fmt.Errorf("unable to unmarshall %s: %v", dockerArchiveManifest, err)
+	}
+
+	var eg errgroup.Group
+	for i, entry := range entries {
+		imageRef := ""
+		if len(entry.RepoTags) > 0 {
+			imageRef = entry.RepoTags[0]
+		}
+
+		archive := addImageSource(archiveNameForImage(imageRef, entry.Config), entry.Config, CompressedMultiArchive)
+
+		imageArchiveSrc := fmt.Sprintf("docker-archive:%s:@%d", MultiArchive, i)
+		eg.Go(func() error {
+			return imageCopy(imageArchiveSrc, "docker-archive:"+archive)
+		})
+	}
+
+	return eg.Wait()
+}
+
+func shortDigest(digest string) string {
+	// docker archives name configs blobs/sha256/<hex> or <hex>.json
+	digest = strings.TrimSuffix(path.Base(digest), ".json")
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if len(digest) > 12 {
+		digest = digest[:12]
+	}
+	return digest
+}
+
+func normalizeImageName(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return reference.TagNameOnly(named).String()
+}
+
+// archiveNameForImage names the individual archive after the repository and
+// tag of the image, falling back to its digest for untagged images.
+func archiveNameForImage(image, digest string) string {
+	digest = shortDigest(digest)
+
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "image-" + digest + ".tar"
+	}
+
+	imageName := path.Base(reference.Path(named))
+	if tagged, ok := reference.TagNameOnly(named).(reference.NamedTagged); ok {
+		return imageName + "-" + tagged.Tag() + ".tar"
+	}
+	return imageName + "-" + digest + ".tar"
+}
+
+// addImageSource returns the path of a new individual archive attributed to
+// source, the digest disambiguates images sharing a name and tag.
+func addImageSource(archiveName, digest, source string) string {
+	archive := filepath.Join(IndividualArchivesDir, archiveName)
+	if _, ok := ImageSources[archive]; ok {
+		archive = strings.TrimSuffix(archive, ".tar") + "-" + shortDigest(digest) + ".tar"
+	}
+	ImageSources[archive] = source
+	return archive
+}
+
+// setUnattributedImageSources attributes every individual archive without a
+// source yet to the given one.
+func setUnattributedImageSources(source string) error {
+	archives, err := filepath.Glob(filepath.Join(IndividualArchivesDir, "*.tar"))
+	if err != nil {
+		return fmt.Errorf("error finding tar files: %w", err)
+	}
+
+	for _, archive := range archives {
+		if _, ok := ImageSources[archive]; !ok {
+			ImageSources[archive] = source
+		}
+	}
+	return nil
+}
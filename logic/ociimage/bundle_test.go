@@ -0,0 +1,124 @@
+package ociimage
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestTar writes a tar of empty regular files with the given names.
+func writeTestTar(t *testing.T, names ...string) string {
+	t.Helper()
+	tarFilePath := filepath.Join(t.TempDir(), "bundle.tar")
+	file, err := os.Create(tarFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tarWriter := tar.NewWriter(file)
+	for _, name := range names {
+		if err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return tarFilePath
+}
+
+func TestBundleLayout(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    layout
+	}{
+		{
+			name:    "zarf package",
+			entries: []string{"zarf.yaml", "checksums.txt", "images/index.json", "images/oci-layout", "images/blobs/sha256/abc"},
+			want:    zarfLayout,
+		},
+		{
+			// the Zarf config wins over the OCI index of its images
+			name:    "zarf package with a top level index",
+			entries: []string{"./index.json", "./zarf.yaml"},
+			want:    zarfLayout,
+		},
+		{
+			name:    "oci multi-archive",
+			entries: []string{"./oci-layout", "./index.json", "./blobs/sha256/abc"},
+			want:    ociLayout,
+		},
+		{
+			name:    "rke2 images",
+			entries: []string{"manifest.json", "repositories", "0123.json", "abcd/layer.tar"},
+			want:    dockerArchiveLayout,
+		},
+		{
+			// the manifest of the images of a Zarf package is not at the top
+			name:    "nested manifest",
+			entries: []string{"images/manifest.json", "images/index.json"},
+			want:    unknownLayout,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := tarEntryNames(writeTestTar(t, test.entries...))
+			if err != nil {
+				t.Fatalf("tarEntryNames() error = %v", err)
+			}
+			if got := bundleLayout(entries); got != test.want {
+				t.Errorf("bundleLayout(%v) = %v, want %v", test.entries, got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadTarEntry(t *testing.T) {
+	tarFilePath := writeTestTar(t, "./manifest.json", "repositories")
+	if _, err := readTarEntry(tarFilePath, "manifest.json"); err != nil {
+		t.Errorf("readTarEntry(manifest.json) error = %v", err)
+	}
+	if _, err := readTarEntry(tarFilePath, "index.json"); err == nil {
+		t.Errorf("readTarEntry(index.json) error = nil, want an error")
+	}
+}
+
+func TestArchiveNameForImage(t *testing.T) {
+	tests := []struct {
+		image  string
+		digest string
+		want   string
+	}{
+		{image: "docker.io/rancher/mirrored-pause:3.6", digest: "sha256:0123456789abcdef", want: "mirrored-pause-3.6.tar"},
+		{image: "nginx", digest: "sha256:0123456789abcdef", want: "nginx-latest.tar"},
+		{image: "ghcr.io/defenseunicorns/zarf/agent@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", digest: "sha256:fedcba9876543210", want: "agent-fedcba987654.tar"},
+		// docker archive configs are named after the config digest
+		{image: "", digest: "0123456789abcdef.json", want: "image-0123456789ab.tar"},
+		{image: "", digest: "blobs/sha256/0123456789abcdef", want: "image-0123456789ab.tar"},
+	}
+	for _, test := range tests {
+		if got := archiveNameForImage(test.image, test.digest); got != test.want {
+			t.Errorf("archiveNameForImage(%q, %q) = %q, want %q", test.image, test.digest, got, test.want)
+		}
+	}
+}
+
+func TestAddImageSourceDisambiguatesNames(t *testing.T) {
+	defer func(sources map[string]string) { ImageSources = sources }(ImageSources)
+	ImageSources = map[string]string{}
+
+	first := addImageSource("pause-3.6.tar", "sha256:aaaaaaaaaaaaaaaa", "rke2-images.linux-amd64.tar.zst")
+	second := addImageSource("pause-3.6.tar", "sha256:bbbbbbbbbbbbbbbb", "zarf-package-demo-amd64.tar.zst (Zarf package demo)")
+	if first == second {
+		t.Fatalf("addImageSource() returned %s twice", first)
+	}
+	if want := filepath.Join(IndividualArchivesDir, "pause-3.6-bbbbbbbbbbbb.tar"); second != want {
+		t.Errorf("addImageSource() = %s, want %s", second, want)
+	}
+	if ImageSources[first] != "rke2-images.linux-amd64.tar.zst" {
+		t.Errorf("ImageSources[%s] = %q", first, ImageSources[first])
+	}
+}
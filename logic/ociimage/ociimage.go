@@ -2,20 +2,20 @@ package ociimage
 
 import (
 	"archive/tar"
-	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
-	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/containers/image/v5/copy"
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/transports/alltransports"
 	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -32,6 +32,19 @@ var (
 	MultiArchive           string
 )
 
+// ImageLayerBlobs maps every individual archive to the layer blobs of the
+// image in the bundle, as stored there, in the order of the layers.
+var (
+	ImageLayerBlobs      = map[string][]LayerBlob{}
+	imageLayerBlobsMutex sync.Mutex
+)
+
+type LayerBlob struct {
+	Digest    string
+	Size      int64
+	MediaType string
+}
+
 type ImageIndex struct {
 	SchemaVersion int        `json:"schemaVersion"`
 	MediaType     string     `json:"mediaType"`
@@ -60,33 +73,6 @@ type PolicyEntry struct {
 	Type string `json:"type"`
 }
 
-func TransformAndCopyOciToDockerImage(ovaImagePath string) error {
-	CompressedMultiArchive = path.Base(ovaImagePath)
-	MultiArchive = tempDir + "/" + CompressedMultiArchive
-
-	file, err := os.Open(CompressedMultiArchive)
-	if err != nil {
-		return fmt.Errorf("error opening compressed file %s: %v", CompressedMultiArchive, err)
-	}
-	defer file.Close()
-
-	if err := extractTarGz(file, MultiArchive, multiArchiveExtractedDir); err != nil {
-		return fmt.Errorf("error extracting archive: %v", err)
-	}
-
-	indexContents, err := unmarshallIndex(ociImageIndexFilePath)
-	if err != nil {
-		return fmt.Errorf("error extracting index contents: %v", err)
-	}
-
-	err = transformOciToDockerImageFormat(indexContents)
-	if err != nil {
-		return fmt.Errorf("error copying OCI image to Docker image: %v", err)
-	}
-
-	return nil
-}
-
 func transformOciToDockerImageFormat(imgIndex ImageIndex) error {
 	// spawn a goroutine for each skopeo copy call
 	var eg errgroup.Group
@@ -101,9 +87,11 @@ func transformOciToDockerImageFormat(imgIndex ImageIndex) error {
 			imageRef := manifest.Annotations["org.opencontainers.image.ref.name"]
 
 			imageArchiveSrc := "oci-archive:" + MultiArchive + ":" + imageRef
-			imageArchiveDst := "docker-archive:" + IndividualArchivesDir + "/" + imageName + "-" + imageRef + ".tar"
-			err := imageCopy(imageArchiveSrc, imageArchiveDst)
-			return err
+			archive := IndividualArchivesDir + "/" + imageName + "-" + imageRef + ".tar"
+			if err := imageCopy(imageArchiveSrc, "docker-archive:"+archive); err != nil {
+				return err
+			}
+			return recordLayerBlobs(multiArchiveExtractedDir, manifest.Digest, archive)
 		})
 	}
 	return eg.Wait()
@@ -142,6 +130,36 @@ func imageCopy(ociImage, dockerImage string) error {
 	return nil
 }
 
+// recordLayerBlobs reads the layer blobs of an image from its manifest in an
+// extracted OCI layout, the individual archive stores the layers
+// uncompressed while the bundle blobs are what the OVA ships. Docker archive
+// bundles store their layers uncompressed and have none to record.
+func recordLayerBlobs(layoutDir, manifestDigest, archive string) error {
+	manifestJson, err := os.ReadFile(filepath.Join(layoutDir, "blobs", strings.Replace(manifestDigest, ":", "/", 1)))
+	if err != nil {
+		return fmt.Errorf("unable to read manifest %s: %v", manifestDigest, err)
+	}
+
+	var manifest imgspecv1.Manifest
+	if err := json.Unmarshal(manifestJson, &manifest); err != nil {
+		return fmt.Errorf("unable to unmarshall manifest %s: %v", manifestDigest, err)
+	}
+	// the copy picks one instance of an image index, its blobs are unknown here
+	if manifest.MediaType == imgspecv1.MediaTypeImageIndex || len(manifest.Layers) == 0 {
+		return nil
+	}
+
+	var layerBlobs []LayerBlob
+	for _, layer := range manifest.Layers {
+		layerBlobs = append(layerBlobs, LayerBlob{Digest: layer.Digest.String(), Size: layer.Size, MediaType: layer.MediaType})
+	}
+	imageLayerBlobsMutex.Lock()
+	ImageLayerBlobs[archive] = layerBlobs
+	imageLayerBlobsMutex.Unlock()
+
+	return nil
+}
+
 func unmarshallIndex(indexPath string) (ImageIndex, error) {
 	var imgIndex ImageIndex
 
@@ -164,18 +182,12 @@ func unmarshallIndex(indexPath string) (ImageIndex, error) {
 	return imgIndex, nil
 }
 
-func decompressGzip(gzipStream io.Reader, tarFilePath string) error {
-	uncompressedStream, err := gzip.NewReader(gzipStream)
-	if err != nil {
-		return fmt.Errorf("error creating gzip reader: %v", err)
-	}
-	defer uncompressedStream.Close()
-
+func prepareTempDir() error {
 	if err := os.RemoveAll(tempDir); err != nil {
 		return fmt.Errorf("error removing directory %s: %v", tempDir, err)
 	}
 
-	err = os.Mkdir(tempDir, 0755)
+	err := os.Mkdir(tempDir, 0755)
 	if err != nil {
 		return fmt.Errorf("error creating temp dir: %v", err)
 	}
@@ -185,6 +197,14 @@ func decompressGzip(gzipStream io.Reader, tarFilePath string) error {
 		return fmt.Errorf("error creating directory %s: %v", IndividualArchivesDir, err)
 	}
 
+	return nil
+}
+
+func writeTar(uncompressedStream io.Reader, tarFilePath string) error {
+	if err := prepareTempDir(); err != nil {
+		return err
+	}
+
 	tarFile, err := os.Create(tarFilePath)
 	if err != nil {
 		return fmt.Errorf("error creating tar file: %v", err)
@@ -242,15 +262,6 @@ func extractTar(tarFilePath, dest string) error {
 	}
 }
 
-func extractTarGz(gzipStream io.Reader, tarFilePath, dest string) error {
-	err := decompressGzip(gzipStream, tarFilePath)
-	if err != nil {
-		return err
-	}
-
-	return extractTar(tarFilePath, dest)
-}
-
 func checkPolicyAndCreateIfMissing() error {
 	if _, err := os.Stat(defaultPolicyFilePath); err == nil {
 		fmt.Printf("File %s exists.\n", defaultPolicyFilePath)
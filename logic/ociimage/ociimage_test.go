@@ -0,0 +1,56 @@
+package ociimage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRecordLayerBlobs(t *testing.T) {
+	const (
+		imageManifest = `{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.manifest.v1+json",` +
+			`"config": {"mediaType": "application/vnd.oci.image.config.v1+json", "digest": "sha256:c0", "size": 10},` +
+			`"layers": [{"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "digest": "sha256:l1", "size": 100},` +
+			`{"mediaType": "application/vnd.oci.image.layer.v1.tar+zstd", "digest": "sha256:l2", "size": 20}]}`
+		indexManifest = `{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.index.v1+json", "manifests": []}`
+	)
+	tests := []struct {
+		name     string
+		manifest string
+		want     []LayerBlob
+	}{
+		{
+			name:     "image manifest",
+			manifest: imageManifest,
+			want: []LayerBlob{
+				{Digest: "sha256:l1", Size: 100, MediaType: "application/vnd.oci.image.layer.v1.tar+gzip"},
+				{Digest: "sha256:l2", Size: 20, MediaType: "application/vnd.oci.image.layer.v1.tar+zstd"},
+			},
+		},
+		{name: "image index", manifest: indexManifest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layoutDir := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(layoutDir, "blobs", "sha256"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(layoutDir, "blobs", "sha256", "m1"), []byte(test.manifest), 0644); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { delete(ImageLayerBlobs, "app.tar") })
+
+			if err := recordLayerBlobs(layoutDir, "sha256:m1", "app.tar"); err != nil {
+				t.Fatalf("recordLayerBlobs() error: %v", err)
+			}
+			if got := ImageLayerBlobs["app.tar"]; !reflect.DeepEqual(got, test.want) {
+				t.Errorf("recordLayerBlobs() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+
+	if err := recordLayerBlobs(t.TempDir(), "sha256:missing", "app.tar"); err == nil {
+		t.Errorf("recordLayerBlobs() of a missing manifest succeeded, want an error")
+	}
+}
@@ -0,0 +1,111 @@
+package ova
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+var manifestLineRe = regexp.MustCompile(`^(SHA1|SHA256|SHA512)\(`)
+
+var digestAlgorithms = map[string]crypto.Hash{
+	"SHA1":   crypto.SHA1,
+	"SHA256": crypto.SHA256,
+	"SHA512": crypto.SHA512,
+}
+
+// manifestAlgorithm keeps the digest algorithm of an existing manifest so
+// that tools validating the OVA see the same kind of manifest as before.
+func manifestAlgorithm(manifest string) string {
+	for _, line := range strings.Split(manifest, "\n") {
+		if matches := manifestLineRe.FindStringSubmatch(strings.TrimSpace(line)); matches != nil {
+			return matches[1]
+		}
+	}
+	return "SHA256"
+}
+
+func digest(algorithm string, r io.Reader) (string, error) {
+	hash := digestAlgorithms[algorithm].New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func manifestLine(algorithm, name, digest string) string {
+	return fmt.Sprintf("%s(%s)= %s\n", algorithm, name, digest)
+}
+
+// signManifest produces the content of the OVA certificate file: the
+// signature of the manifest followed by the signing certificate.
+func signManifest(algorithm, manifestName, manifest, keyPath, certPath string) (string, error) {
+	signer, err := loadSigner(keyPath)
+	if err != nil {
+		return "", err
+	}
+
+	certificate, err := os.ReadFile(certPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading certificate %s: %w", certPath, err)
+	}
+	if block, _ := pem.Decode(certificate); block == nil || block.Type != "CERTIFICATE" {
+		return "", fmt.Errorf("no PEM certificate found in %s", certPath)
+	}
+
+	hashType := digestAlgorithms[algorithm]
+	hash := hashType.New()
+	hash.Write([]byte(manifest))
+
+	signature, err := signer.Sign(rand.Reader, hash.Sum(nil), hashType)
+	if err != nil {
+		return "", fmt.Errorf("error signing manifest: %w", err)
+	}
+
+	return manifestLine(algorithm, manifestName, hex.EncodeToString(signature)) + string(certificate), nil
+}
+
+func loadSigner(keyPath string) (crypto.Signer, error) {
+	keyPem, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key %s: %w", keyPath, err)
+	}
+
+	block, _ := pem.Decode(keyPem)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM key found in %s", keyPath)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported private key in %s: %w", keyPath, err)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T in %s", key, keyPath)
+	}
+}
@@ -0,0 +1,87 @@
+package ova
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// the OVF descriptor is edited textually so that everything not touched by a
+// repack (namespaces, comments, vendor sections) is kept byte for byte
+var (
+	fileTagRe = regexp.MustCompile(`<(?:\w+:)?File\s[^>]*>`)
+	diskTagRe = regexp.MustCompile(`<(?:\w+:)?Disk\s[^>]*>`)
+	// attrRe matches every attribute of a tag, with its namespace prefix
+	attrRe = regexp.MustCompile(`(\s(?:\w+:)?)(\w+)="([^"]*)"`)
+)
+
+type ovfFile struct {
+	ID   string
+	Href string
+}
+
+func attr(tag, name string) string {
+	for _, matches := range attrRe.FindAllStringSubmatch(tag, -1) {
+		if matches[2] == name {
+			return matches[3]
+		}
+	}
+	return ""
+}
+
+// setAttr sets an attribute of a tag, a missing one is added at the end of
+// the tag with the namespace prefix of the first attribute.
+func setAttr(tag, name, value string) string {
+	found := false
+	tag = attrRe.ReplaceAllStringFunc(tag, func(attribute string) string {
+		matches := attrRe.FindStringSubmatch(attribute)
+		if matches[2] != name {
+			return attribute
+		}
+		found = true
+		return matches[1] + matches[2] + `="` + value + `"`
+	})
+	if found {
+		return tag
+	}
+
+	prefix := " "
+	if matches := attrRe.FindStringSubmatch(tag); matches != nil {
+		prefix = matches[1]
+	}
+	end := strings.TrimRight(strings.TrimSuffix(tag, ">"), "/ \t\n")
+	return end + prefix + name + `="` + value + `"` + tag[len(end):]
+}
+
+// ovfFiles returns the References section files in declaration order.
+func ovfFiles(descriptor string) []ovfFile {
+	var files []ovfFile
+	for _, tag := range fileTagRe.FindAllString(descriptor, -1) {
+		files = append(files, ovfFile{ID: attr(tag, "id"), Href: attr(tag, "href")})
+	}
+	return files
+}
+
+// updateOvf sets the size of every referenced file and the populated size of
+// every disk backed by one of them. Files missing from sizes are untouched.
+func updateOvf(descriptor string, sizes, populatedSizes map[string]int64) string {
+	hrefByID := map[string]string{}
+
+	descriptor = fileTagRe.ReplaceAllStringFunc(descriptor, func(tag string) string {
+		href := attr(tag, "href")
+		hrefByID[attr(tag, "id")] = href
+
+		if size, ok := sizes[href]; ok {
+			tag = setAttr(tag, "size", strconv.FormatInt(size, 10))
+		}
+		return tag
+	})
+
+	return diskTagRe.ReplaceAllStringFunc(descriptor, func(tag string) string {
+		href := hrefByID[attr(tag, "fileRef")]
+		if populatedSize, ok := populatedSizes[href]; ok {
+			tag = setAttr(tag, "populatedSize", strconv.FormatInt(populatedSize, 10))
+		}
+		return tag
+	})
+}
@@ -0,0 +1,58 @@
+package ova
+
+import "testing"
+
+func TestAttr(t *testing.T) {
+	tests := []struct {
+		tag  string
+		name string
+		want string
+	}{
+		{tag: `<File ovf:id="file1" ovf:href="disk1.vmdk" ovf:size="42"/>`, name: "href", want: "disk1.vmdk"},
+		{tag: `<File id="file1" href="disk1.vmdk"/>`, name: "id", want: "file1"},
+		{tag: `<Disk ovf:diskId="vmdisk1" ovf:fileRef="file1"/>`, name: "fileRef", want: "file1"},
+		{tag: `<Disk ovf:diskId="vmdisk1"/>`, name: "fileRef", want: ""},
+		{tag: `<File ovf:href="disk1.vmdk" ovf:chunkSize="42"/>`, name: "size", want: ""},
+	}
+	for _, test := range tests {
+		if got := attr(test.tag, test.name); got != test.want {
+			t.Errorf("attr(%s, %s) = %q, want %q", test.tag, test.name, got, test.want)
+		}
+	}
+}
+
+func TestUpdateOvf(t *testing.T) {
+	descriptor := `<ovf:References><ovf:File ovf:id="file1" ovf:href="disk1.vmdk" ovf:size="100"/>` +
+		`<ovf:File ovf:id="file2" ovf:href="disk2.vmdk" ovf:size="200"/></ovf:References>` +
+		`<ovf:Disk ovf:diskId="vmdisk1" ovf:fileRef="file1" ovf:populatedSize="1000"/>` +
+		`<ovf:Disk ovf:diskId="vmdisk2" ovf:fileRef="file2" ovf:populatedSize="2000"/>`
+	want := `<ovf:References><ovf:File ovf:id="file1" ovf:href="disk1.vmdk" ovf:size="50"/>` +
+		`<ovf:File ovf:id="file2" ovf:href="disk2.vmdk" ovf:size="200"/></ovf:References>` +
+		`<ovf:Disk ovf:diskId="vmdisk1" ovf:fileRef="file1" ovf:populatedSize="500"/>` +
+		`<ovf:Disk ovf:diskId="vmdisk2" ovf:fileRef="file2" ovf:populatedSize="2000"/>`
+
+	got := updateOvf(descriptor, map[string]int64{"disk1.vmdk": 50}, map[string]int64{"disk1.vmdk": 500})
+	if got != want {
+		t.Errorf("updateOvf() = %s, want %s", got, want)
+	}
+}
+
+func TestSetAttr(t *testing.T) {
+	tests := []struct {
+		tag   string
+		name  string
+		value string
+		want  string
+	}{
+		{tag: `<ovf:File ovf:id="file1" ovf:size="100"/>`, name: "size", value: "50", want: `<ovf:File ovf:id="file1" ovf:size="50"/>`},
+		// a missing attribute is added with the namespace of the others
+		{tag: `<ovf:File ovf:id="file1" ovf:href="disk1.vmdk"/>`, name: "size", value: "50", want: `<ovf:File ovf:id="file1" ovf:href="disk1.vmdk" ovf:size="50"/>`},
+		{tag: `<Disk diskId="vmdisk1" fileRef="file1">`, name: "populatedSize", value: "500", want: `<Disk diskId="vmdisk1" fileRef="file1" populatedSize="500">`},
+		{tag: "<ovf:Disk ovf:diskId=\"vmdisk1\"\n  />", name: "populatedSize", value: "500", want: "<ovf:Disk ovf:diskId=\"vmdisk1\" ovf:populatedSize=\"500\"\n  />"},
+	}
+	for _, test := range tests {
+		if got := setAttr(test.tag, test.name, test.value); got != test.want {
+			t.Errorf("setAttr(%s, %s, %s) = %s, want %s", test.tag, test.name, test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package ova
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"ova-size-optimizer/logic/disk"
+)
+
+type RepackOptions struct {
+	// Replacements maps an OVA entry name to the local file replacing it.
+	Replacements map[string]string
+	KeyPath      string
+	CertPath     string
+}
+
+type RepackResult struct {
+	OldSize            int64
+	NewSize            int64
+	Files              []RepackedFile
+	Signed             bool
+	DroppedCertificate bool
+}
+
+type RepackedFile struct {
+	Name     string
+	OldSize  int64
+	NewSize  int64
+	Replaced bool
+}
+
+type repackSource struct {
+	name        string
+	oldSize     int64
+	size        int64
+	replacement string
+	entry       disk.Entry
+}
+
+// Repack writes a new OVA from an existing one, optionally replacing some of
+// its files. The OVF descriptor is written first, followed by the manifest,
+// the certificate and the referenced files in References order.
+func Repack(ovaPath, outPath string, options RepackOptions) (*RepackResult, error) {
+	fmt.Println("Started repacking ova:", ovaPath)
+
+	bundle, err := disk.OpenBundle(ovaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer bundle.Close()
+
+	var descriptorEntry, manifestEntry, certEntry *disk.Entry
+	var sources []*repackSource
+	for _, entry := range bundle.Entries {
+		entry := entry
+		switch strings.ToLower(path.Ext(entry.Name)) {
+		case ".ovf":
+			descriptorEntry = &entry
+		case ".mf":
+			manifestEntry = &entry
+		case ".cert":
+			certEntry = &entry
+		default:
+			sources = append(sources, &repackSource{name: entry.Name, oldSize: entry.Size, size: entry.Size, entry: entry})
+		}
+	}
+	if descriptorEntry == nil {
+		return nil, fmt.Errorf("no OVF descriptor found in %s", ovaPath)
+	}
+
+	sourcesByName := map[string]*repackSource{}
+	for _, source := range sources {
+		sourcesByName[source.name] = source
+	}
+
+	sizes := map[string]int64{}
+	populatedSizes := map[string]int64{}
+	for name, replacement := range options.Replacements {
+		source, ok := sourcesByName[name]
+		if !ok {
+			return nil, fmt.Errorf("file %s to replace not found in %s", name, ovaPath)
+		}
+
+		info, err := os.Stat(replacement)
+		if err != nil {
+			return nil, fmt.Errorf("error reading replacement %s: %w", replacement, err)
+		}
+		source.replacement = replacement
+		source.size = info.Size()
+		sizes[name] = source.size
+
+		if populatedSize, ok, err := replacementPopulatedSize(replacement); err != nil {
+			return nil, err
+		} else if ok {
+			populatedSizes[name] = populatedSize
+		}
+	}
+
+	descriptorBytes, err := io.ReadAll(bundle.Open(*descriptorEntry))
+	if err != nil {
+		return nil, fmt.Errorf("error reading OVF descriptor: %w", err)
+	}
+	descriptor := updateOvf(string(descriptorBytes), sizes, populatedSizes)
+	sources = orderSources(sources, ovfFiles(descriptor))
+
+	algorithm := "SHA256"
+	if manifestEntry != nil {
+		oldManifest, err := io.ReadAll(bundle.Open(*manifestEntry))
+		if err != nil {
+			return nil, fmt.Errorf("error reading manifest: %w", err)
+		}
+		algorithm = manifestAlgorithm(string(oldManifest))
+	}
+
+	manifestName := strings.TrimSuffix(descriptorEntry.Name, path.Ext(descriptorEntry.Name)) + ".mf"
+	manifest, err := buildManifest(bundle, algorithm, descriptorEntry.Name, descriptor, sources)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RepackResult{}
+	var cert string
+	if options.KeyPath != "" {
+		cert, err = signManifest(algorithm, path.Base(manifestName), manifest, options.KeyPath, options.CertPath)
+		if err != nil {
+			return nil, err
+		}
+		result.Signed = true
+	} else if certEntry != nil {
+		// the old signature no longer matches the new manifest
+		result.DroppedCertificate = true
+	}
+
+	if err := writeOva(bundle, outPath, descriptorEntry.Name, descriptor, manifestName, manifest, cert, sources); err != nil {
+		return nil, err
+	}
+
+	if result.OldSize, err = fileSize(ovaPath); err != nil {
+		return nil, err
+	}
+	if result.NewSize, err = fileSize(outPath); err != nil {
+		return nil, err
+	}
+	for _, source := range sources {
+		result.Files = append(result.Files, RepackedFile{
+			Name:     source.name,
+			OldSize:  source.oldSize,
+			NewSize:  source.size,
+			Replaced: source.replacement != "",
+		})
+	}
+
+	fmt.Println("Finished repacking ova successfully.")
+	return result, nil
+}
+
+// replacementPopulatedSize is the guest data a replacement disk holds. A raw
+// image stores every byte, its zero grains are not counted.
+func replacementPopulatedSize(replacement string) (int64, bool, error) {
+	switch strings.ToLower(path.Ext(replacement)) {
+	case ".vmdk", ".qcow2", ".raw", ".img":
+	default:
+		return 0, false, nil
+	}
+
+	img, file, err := disk.OpenImageFile(replacement)
+	if err != nil {
+		return 0, false, err
+	}
+	defer file.Close()
+
+	if img.Format() == "raw" {
+		size, err := disk.NonZeroSize(img)
+		return size, err == nil, err
+	}
+	return disk.PopulatedSize(img), true, nil
+}
+
+// orderSources puts the files in the order of the OVF References section,
+// files not referenced by the descriptor are kept at the end.
+func orderSources(sources []*repackSource, files []ovfFile) []*repackSource {
+	var ordered []*repackSource
+	added := map[string]bool{}
+	for _, file := range files {
+		for _, source := range sources {
+			if source.name == file.Href && !added[source.name] {
+				ordered = append(ordered, source)
+				added[source.name] = true
+			}
+		}
+	}
+
+	for _, source := range sources {
+		if !added[source.name] {
+			ordered = append(ordered, source)
+		}
+	}
+	return ordered
+}
+
+func openSource(bundle *disk.Bundle, source *repackSource) (io.ReadCloser, error) {
+	if source.replacement == "" {
+		return io.NopCloser(bundle.Open(source.entry)), nil
+	}
+
+	file, err := os.Open(source.replacement)
+	if err != nil {
+		return nil, fmt.Errorf("error opening replacement %s: %w", source.replacement, err)
+	}
+	return file, nil
+}
+
+func buildManifest(bundle *disk.Bundle, algorithm, descriptorName, descriptor string, sources []*repackSource) (string, error) {
+	descriptorDigest, err := digest(algorithm, strings.NewReader(descriptor))
+	if err != nil {
+		return "", err
+	}
+	manifest := manifestLine(algorithm, path.Base(descriptorName), descriptorDigest)
+
+	for _, source := range sources {
+		fmt.Println("Computing digest of:", source.name)
+
+		reader, err := openSource(bundle, source)
+		if err != nil {
+			return "", err
+		}
+		sourceDigest, err := digest(algorithm, reader)
+		reader.Close()
+		if err != nil {
+			return "", fmt.Errorf("error computing digest of %s: %w", source.name, err)
+		}
+
+		manifest += manifestLine(algorithm, path.Base(source.name), sourceDigest)
+	}
+
+	return manifest, nil
+}
+
+func writeOva(bundle *disk.Bundle, outPath, descriptorName, descriptor, manifestName, manifest, cert string, sources []*repackSource) error {
+	tmpPath := outPath + ".tmp"
+	outFile, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", tmpPath, err)
+	}
+	defer os.Remove(tmpPath)
+	defer outFile.Close()
+
+	tarWriter := tar.NewWriter(outFile)
+	writeEntry := func(name string, size int64, r io.Reader) error {
+		// the format is left to archive/tar, USTAR can't hold disks of 8GiB
+		// or more nor long names, those fall back to GNU or PAX headers
+		header := &tar.Header{Name: name, Size: size, Mode: 0644, Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return fmt.Errorf("error writing header of %s: %w", name, err)
+		}
+		if _, err := io.Copy(tarWriter, r); err != nil {
+			return fmt.Errorf("error writing %s: %w", name, err)
+		}
+		return nil
+	}
+
+	if err := writeEntry(descriptorName, int64(len(descriptor)), strings.NewReader(descriptor)); err != nil {
+		return err
+	}
+	if err := writeEntry(manifestName, int64(len(manifest)), strings.NewReader(manifest)); err != nil {
+		return err
+	}
+	if cert != "" {
+		certName := strings.TrimSuffix(manifestName, ".mf") + ".cert"
+		if err := writeEntry(certName, int64(len(cert)), strings.NewReader(cert)); err != nil {
+			return err
+		}
+	}
+
+	for _, source := range sources {
+		fmt.Println("Writing:", source.name)
+
+		reader, err := openSource(bundle, source)
+		if err != nil {
+			return err
+		}
+		err = writeEntry(source.name, source.size, reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("error finishing %s: %w", tmpPath, err)
+	}
+	if err := outFile.Close(); err != nil {
+		return fmt.Errorf("error closing %s: %w", tmpPath, err)
+	}
+
+	return os.Rename(tmpPath, outPath)
+}
+
+func fileSize(filePath string) (int64, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s: %w", filePath, err)
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,122 @@
+package ova
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ova-size-optimizer/logic/disk"
+)
+
+func writeTestOva(t *testing.T, ovaPath string, entries map[string]string, order []string) {
+	t.Helper()
+	file, err := os.Create(ovaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tarWriter := tar.NewWriter(file)
+	for _, name := range order {
+		if err := tarWriter.WriteHeader(&tar.Header{Name: name, Size: int64(len(entries[name])), Mode: 0644, Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tarWriter, entries[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepackLargeDiskWithLongName(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes an 8GiB ova")
+	}
+
+	dir := t.TempDir()
+	diskName := "appliance-" + strings.Repeat("x", 100) + "-disk1.img"
+	descriptor := `<Envelope xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1"><References>` +
+		`<File ovf:id="file1" ovf:href="` + diskName + `" ovf:size="4"/></References></Envelope>`
+	ovaPath := filepath.Join(dir, "appliance.ova")
+	writeTestOva(t, ovaPath, map[string]string{"appliance.ovf": descriptor, diskName: "disk"}, []string{"appliance.ovf", diskName})
+
+	// sparse, so only the repacked ova takes space
+	const largeSize = 8<<30 + 1
+	replacement := filepath.Join(dir, "large.img")
+	if err := os.WriteFile(replacement, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(replacement, largeSize); err != nil {
+		t.Fatal(err)
+	}
+
+	outPath := filepath.Join(dir, "repacked.ova")
+	result, err := Repack(ovaPath, outPath, RepackOptions{Replacements: map[string]string{diskName: replacement}})
+	if err != nil {
+		t.Fatalf("Repack() error = %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].NewSize != largeSize || !result.Files[0].Replaced {
+		t.Errorf("Repack() files = %+v, want %s replaced with %d bytes", result.Files, diskName, int64(largeSize))
+	}
+
+	bundle, err := disk.OpenBundle(outPath)
+	if err != nil {
+		t.Fatalf("error reading repacked ova: %v", err)
+	}
+	defer bundle.Close()
+
+	entries := map[string]disk.Entry{}
+	for _, entry := range bundle.Entries {
+		entries[entry.Name] = entry
+	}
+	if entry, ok := entries[diskName]; !ok || entry.Size != largeSize {
+		t.Errorf("repacked disk entry = %+v, want %s of %d bytes", entry, diskName, int64(largeSize))
+	}
+	repackedDescriptor, err := io.ReadAll(bundle.Open(entries["appliance.ovf"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(repackedDescriptor), `ovf:size="8589934593"`) {
+		t.Errorf("repacked descriptor = %s, want the size of the large disk", repackedDescriptor)
+	}
+	manifest, err := io.ReadAll(bundle.Open(entries["appliance.mf"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(manifest), "SHA256("+diskName+")= ") {
+		t.Errorf("repacked manifest = %s, want a digest of %s", manifest, diskName)
+	}
+}
+
+func TestReplacementPopulatedSize(t *testing.T) {
+	dir := t.TempDir()
+	// a raw image of four 64KiB grains, the second one holding data
+	raw := make([]byte, 4<<16)
+	copy(raw[1<<16+10:], "data")
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    int64
+		wantOk  bool
+	}{
+		{name: "disk.raw", content: raw, want: 1 << 16, wantOk: true},
+		{name: "disk.img", content: make([]byte, 4<<16), want: 0, wantOk: true},
+		{name: "disk.iso", content: raw, wantOk: false},
+	}
+	for _, test := range tests {
+		replacement := filepath.Join(dir, test.name)
+		if err := os.WriteFile(replacement, test.content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, ok, err := replacementPopulatedSize(replacement)
+		if err != nil || got != test.want || ok != test.wantOk {
+			t.Errorf("replacementPopulatedSize(%s) = %d, %v, %v, want %d, %v, nil", test.name, got, ok, err, test.want, test.wantOk)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package visualize
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"ova-size-optimizer/logic/analyze"
+)
+
+// GenerateBaseImageReport prints the tree of base images and of the images
+// derived from them, every image sized by its own layers.
+func GenerateBaseImageReport(bases []*analyze.BaseImage) {
+	if len(bases) == 0 {
+		fmt.Println("Base images: none")
+		return
+	}
+
+	fmt.Println("Base images:")
+	for _, base := range bases {
+		printBaseImage(base, 0, 1)
+	}
+}
+
+func printBaseImage(base *analyze.BaseImage, parentLayers, depth int) {
+	indent := strings.Repeat("\t", depth)
+	fmt.Printf("%s%s: %d layers, %s", indent, base.Name, len(base.Layers), ConvertSizeBytesToHumanReadableString(base.Size))
+	if parentLayers > 0 {
+		fmt.Printf(" (%d layers on top of its base)", len(base.Layers)-parentLayers)
+	}
+	fmt.Printf(", shared by %d images\n", countDerivedImages(base))
+
+	for _, image := range base.Images {
+		fmt.Printf("%s\t%s: %d own layers, %s\n", indent, filepath.Base(image.Name), image.OwnLayers,
+			ConvertSizeBytesToHumanReadableString(image.OwnSize))
+	}
+	for _, derivedBase := range base.Bases {
+		printBaseImage(derivedBase, len(base.Layers), depth+1)
+	}
+}
+
+func countDerivedImages(base *analyze.BaseImage) int {
+	count := len(base.Images)
+	for _, derivedBase := range base.Bases {
+		count += countDerivedImages(derivedBase)
+	}
+	return count
+}
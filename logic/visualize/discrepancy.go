@@ -0,0 +1,37 @@
+package visualize
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"ova-size-optimizer/logic/analyze"
+)
+
+// GenerateSizeDiscrepancyReport lists the packages whose declared installed
+// size is far from the size of their files found on disk.
+func GenerateSizeDiscrepancyReport(packages map[string]*analyze.Info) {
+	var identities []string
+	for identity, info := range packages {
+		if info.HasSizeDiscrepancy() {
+			identities = append(identities, identity)
+		}
+	}
+	if len(identities) == 0 {
+		fmt.Println("Packages with a declared size far from their size on disk: none")
+		return
+	}
+	sort.Strings(identities)
+
+	fmt.Printf("Packages with a declared size far from their size on disk: %d\n", len(identities))
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tpackage\tdeclared\ton disk\timages")
+	for _, identity := range identities {
+		info := packages[identity]
+		fmt.Fprintf(writer, "\t%s\t%s\t%s\t%d\n", identity,
+			ConvertSizeBytesToHumanReadableString(info.InstalledSize),
+			ConvertSizeBytesToHumanReadableString(info.OnDiskSize), info.Count)
+	}
+	writer.Flush()
+}
@@ -0,0 +1,137 @@
+package visualize
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"ova-size-optimizer/logic/disk"
+)
+
+func GenerateFreeSpaceReport(reports []*disk.FreeSpaceReport) error {
+	fmt.Println("Started generating free space report...")
+
+	var bundles []string
+	bundleSavings := map[string]int64{}
+	bundleSparseSavings := map[string]int64{}
+	for _, report := range reports {
+		fmt.Printf("Disk %s (%s): virtual %s, stored %s in %d grains\n", report.Disk, report.Format,
+			ConvertSizeBytesToHumanReadableString(report.VirtualSize),
+			ConvertSizeBytesToHumanReadableString(report.StoredSize),
+			report.AllocatedGrains)
+
+		for _, partition := range report.Partitions {
+			if partition.Filesystem == "unsupported" {
+				fmt.Printf("\tpartition %d (%s): filesystem not supported, skipped\n", partition.Partition.Index, partition.Partition.Type)
+				continue
+			}
+
+			fmt.Printf("\tpartition %d (%s, %s): %s free\n", partition.Partition.Index, partition.Partition.Type, partition.Filesystem,
+				ConvertSizeBytesToHumanReadableString(partition.FreeBytes))
+			fmt.Printf("\t\t%d grains stored in free blocks (%d non-zero), %s in the disk image\n",
+				partition.FreeGrains, partition.FreeNonZeroGrains,
+				ConvertSizeBytesToHumanReadableString(partition.FreeStoredBytes))
+			fmt.Printf("\t\t%d grains partially in free blocks, %s of stale data\n",
+				partition.PartialGrains, ConvertSizeBytesToHumanReadableString(partition.PartialNonZeroBytes))
+			if report.Format != "raw" {
+				fmt.Printf("\t\testimated saving: %s\n", ConvertSizeBytesToHumanReadableString(partition.EstimatedSavings))
+			}
+		}
+
+		if _, ok := bundleSavings[report.Bundle]; !ok {
+			bundles = append(bundles, report.Bundle)
+		}
+		bundleSavings[report.Bundle] += report.EstimatedSavings
+		bundleSparseSavings[report.Bundle] += report.SparseSavings
+	}
+
+	for _, bundle := range bundles {
+		// a raw file keeps its size whatever is trimmed in it
+		if bundleSparseSavings[bundle] > 0 {
+			fmt.Printf("Recommendation: convert the raw disks of %s to a sparse or compressed format, e.g. `qemu-img convert -c -O qcow2` "+
+				"after running `fstrim -av` in the VM, they would shrink by about %s.\n", bundle, ConvertSizeBytesToHumanReadableString(bundleSparseSavings[bundle]))
+		}
+		if bundleSavings[bundle] > 0 {
+			fmt.Printf("Recommendation: run `fstrim -av` (or `zerofree` on unmounted ext4 filesystems) in the VM before export, "+
+				"%s would shrink by about %s.\n", bundle, ConvertSizeBytesToHumanReadableString(bundleSavings[bundle]))
+		} else if bundleSparseSavings[bundle] == 0 {
+			fmt.Printf("No free filesystem blocks with stored data found in %s, trimming would not shrink it.\n", bundle)
+		}
+	}
+
+	generateFormatComparison(reports)
+
+	fmt.Println("Finished generating free space report successfully.")
+	return nil
+}
+
+// generateFormatComparison lists the size of the same appliance shipped in
+// different disk formats, one line per analyzed bundle.
+func generateFormatComparison(reports []*disk.FreeSpaceReport) {
+	type bundleSize struct {
+		formats     map[string]bool
+		fileSize    int64
+		storedSize  int64
+		virtualSize int64
+		usedBytes   int64
+	}
+
+	var bundles []string
+	sizes := map[string]*bundleSize{}
+	for _, report := range reports {
+		if sizes[report.Bundle] == nil {
+			bundles = append(bundles, report.Bundle)
+			sizes[report.Bundle] = &bundleSize{formats: map[string]bool{}}
+		}
+
+		size := sizes[report.Bundle]
+		size.formats[report.Format] = true
+		size.fileSize += report.FileSize
+		size.storedSize += report.StoredSize
+		size.virtualSize += report.VirtualSize
+		size.usedBytes += report.UsedBytes
+	}
+
+	if len(bundles) < 2 {
+		return
+	}
+
+	fmt.Println("Disk format comparison:")
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tbundle\tformat\tdisk files\tstored data\tvirtual\tfilesystem used")
+	for _, bundle := range bundles {
+		size := sizes[bundle]
+
+		var formats []string
+		for format := range size.formats {
+			formats = append(formats, format)
+		}
+		sort.Strings(formats)
+
+		fmt.Fprintf(writer, "\t%s\t%s\t%s\t%s\t%s\t%s\n", bundle, strings.Join(formats, ","),
+			ConvertSizeBytesToHumanReadableString(size.fileSize),
+			ConvertSizeBytesToHumanReadableString(size.storedSize),
+			ConvertSizeBytesToHumanReadableString(size.virtualSize),
+			ConvertSizeBytesToHumanReadableString(size.usedBytes))
+	}
+	writer.Flush()
+}
+
+func GenerateGuestRootFsReport(rootFilesystems []disk.GuestRootFs) {
+	for _, rootFs := range rootFilesystems {
+		fmt.Printf("Guest root filesystem on disk %s (%s) partition %d\n", rootFs.Disk, rootFs.Format, rootFs.Partition.Index)
+
+		var imageStores []string
+		for imageStore := range rootFs.ImageStores {
+			imageStores = append(imageStores, imageStore)
+		}
+		sort.Strings(imageStores)
+
+		for _, imageStore := range imageStores {
+			fmt.Printf("\tcontainer image store %s: %s\n", imageStore,
+				ConvertSizeBytesToHumanReadableString(rootFs.ImageStores[imageStore]))
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package visualize
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"ova-size-optimizer/logic/analyze"
+)
+
+// GenerateDriftReport lists the packages shipped in different versions
+// across images, the largest estimated savings first.
+func GenerateDriftReport(drifts []analyze.PackageDrift) {
+	if len(drifts) == 0 {
+		fmt.Println("Package version drift across images: none")
+		return
+	}
+
+	var totalSavings int64
+	for _, drift := range drifts {
+		totalSavings += drift.EstimatedSavings
+	}
+	fmt.Printf("Package version drift across images: %d packages, converging on the most common versions would save about %s\n",
+		len(drifts), ConvertSizeBytesToHumanReadableString(totalSavings))
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tname\tversion\tdistro\tper copy\timages\timage names")
+	for _, drift := range drifts {
+		for i, variant := range drift.Variants {
+			name := ""
+			if i == 0 {
+				name = fmt.Sprintf("%s (saves %s)", drift.Name, ConvertSizeBytesToHumanReadableString(drift.EstimatedSavings))
+			}
+
+			var imageNames []string
+			for _, image := range variant.Images {
+				imageNames = append(imageNames, filepath.Base(image))
+			}
+
+			fmt.Fprintf(writer, "\t%s\t%s\t%s\t%s\t%d\t%s\n", name, variant.Version, variant.Distro,
+				ConvertSizeBytesToHumanReadableString(variant.Size), len(variant.Images), strings.Join(imageNames, ", "))
+		}
+	}
+	writer.Flush()
+}
@@ -0,0 +1,46 @@
+package visualize
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"ova-size-optimizer/logic/analyze"
+)
+
+// duplicatedFilesShown is how many of the duplicated file contents are
+// listed, the largest waste first.
+const duplicatedFilesShown = 20
+
+// GenerateDuplicatedFileReport lists the file contents stored several times
+// across the layers of the images, with where every copy is.
+func GenerateDuplicatedFileReport(duplicatedFiles []analyze.DuplicatedFile) {
+	if len(duplicatedFiles) == 0 {
+		fmt.Println("Duplicated file contents across layers: none")
+		return
+	}
+
+	var totalWasted int64
+	for _, duplicatedFile := range duplicatedFiles {
+		totalWasted += duplicatedFile.WastedSize
+	}
+	fmt.Printf("Duplicated file contents across layers: %d, %s wasted\n", len(duplicatedFiles),
+		ConvertSizeBytesToHumanReadableString(totalWasted))
+
+	for i, duplicatedFile := range duplicatedFiles {
+		if i == duplicatedFilesShown {
+			fmt.Printf("\t%d other duplicated file contents\n", len(duplicatedFiles)-i)
+			break
+		}
+
+		fmt.Printf("\t%s: %d copies of %s, %s wasted\n", duplicatedFile.Digest, len(duplicatedFile.Occurrences),
+			ConvertSizeBytesToHumanReadableString(duplicatedFile.Size), ConvertSizeBytesToHumanReadableString(duplicatedFile.WastedSize))
+		for _, occurrence := range duplicatedFile.Occurrences {
+			var imageNames []string
+			for _, image := range occurrence.Images {
+				imageNames = append(imageNames, filepath.Base(image))
+			}
+			fmt.Printf("\t\t/%s in layer %s of %s\n", strings.TrimPrefix(occurrence.Path, "/"), occurrence.DiffID, strings.Join(imageNames, ", "))
+		}
+	}
+}
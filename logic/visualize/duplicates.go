@@ -0,0 +1,145 @@
+package visualize
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"ova-size-optimizer/logic/analyze"
+)
+
+// GenerateDuplicationReport lists the base OSes, packages and runtimes found
+// in more than one image, the most duplicated bytes first.
+func GenerateDuplicationReport(rollup *analyze.Rollup) {
+	generateEcosystemSummary(rollup.Packages)
+	generateDuplicatesTable("Base OSes", analyze.GetOnlyDuplicates(rollup.BaseOS))
+	generateDuplicatesTable("Identical packages", analyze.GetOnlyDuplicates(rollup.Packages))
+	generatePackageVariantsTable(rollup.PackagesByName)
+	generateDuplicatesTable("Runtimes", analyze.GetOnlyDuplicates(rollup.Runtimes))
+}
+
+func generateDuplicatesTable(title string, duplicates map[string]*analyze.Info) {
+	if len(duplicates) == 0 {
+		fmt.Printf("%s duplicated across images: none\n", title)
+		return
+	}
+
+	var keys []string
+	var totalDuplicatedSize int64
+	for key, info := range duplicates {
+		keys = append(keys, key)
+		totalDuplicatedSize += info.DuplicatedSize()
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		left, right := duplicates[keys[i]], duplicates[keys[j]]
+		if left.DuplicatedSize() != right.DuplicatedSize() {
+			return left.DuplicatedSize() > right.DuplicatedSize()
+		}
+		if left.Count != right.Count {
+			return left.Count > right.Count
+		}
+		return keys[i] < keys[j]
+	})
+
+	fmt.Printf("%s duplicated across images: %d, %s duplicated in total\n", title, len(keys),
+		ConvertSizeBytesToHumanReadableString(totalDuplicatedSize))
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tname\timages\tper copy\tduplicated\timage names")
+	for _, key := range keys {
+		info := duplicates[key]
+
+		var imageNames []string
+		for _, image := range info.Images {
+			imageNames = append(imageNames, filepath.Base(image))
+		}
+
+		fmt.Fprintf(writer, "\t%s\t%d\t%s\t%s\t%s\n", key, info.Count,
+			ConvertSizeBytesToHumanReadableString(info.CopySize()),
+			ConvertSizeBytesToHumanReadableString(info.DuplicatedSize()),
+			strings.Join(imageNames, ", "))
+	}
+	writer.Flush()
+}
+
+// generatePackageVariantsTable lists the packages shipped in different builds
+// (version, distro or ecosystem) across images, which identical package
+// duplication doesn't account for.
+func generatePackageVariantsTable(packagesByName map[string]*analyze.Info) {
+	var names []string
+	for name, info := range packagesByName {
+		if len(info.Variants) > 1 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Println("Packages with different builds across images: none")
+		return
+	}
+	sort.Slice(names, func(i, j int) bool {
+		left, right := packagesByName[names[i]], packagesByName[names[j]]
+		if left.Count != right.Count {
+			return left.Count > right.Count
+		}
+		return names[i] < names[j]
+	})
+
+	fmt.Printf("Packages with different builds across images: %d\n", len(names))
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tname\timages\tbuilds\tlargest copy\tpackage identities")
+	for _, name := range names {
+		info := packagesByName[name]
+		fmt.Fprintf(writer, "\t%s\t%d\t%d\t%s\t%s\n", name, info.Count, len(info.Variants),
+			ConvertSizeBytesToHumanReadableString(info.CopySize()),
+			strings.Join(info.Variants, ", "))
+	}
+	writer.Flush()
+}
+
+// generateEcosystemSummary totals the packages of every ecosystem, OS
+// packages (apk, deb, rpm, alpm) alongside language ones (maven, npm, pypi...).
+func generateEcosystemSummary(packages map[string]*analyze.Info) {
+	type ecosystemSize struct {
+		packages       int
+		copies         int
+		totalSize      int64
+		duplicatedSize int64
+	}
+
+	var ecosystems []string
+	sizes := map[string]*ecosystemSize{}
+	for identity, info := range packages {
+		ecosystem := analyze.PackageEcosystem(identity)
+		if sizes[ecosystem] == nil {
+			ecosystems = append(ecosystems, ecosystem)
+			sizes[ecosystem] = &ecosystemSize{}
+		}
+
+		size := sizes[ecosystem]
+		size.packages++
+		size.copies += info.Count
+		size.totalSize += int64(info.Count) * info.CopySize()
+		size.duplicatedSize += info.DuplicatedSize()
+	}
+	if len(ecosystems) == 0 {
+		return
+	}
+	sort.Slice(ecosystems, func(i, j int) bool {
+		return sizes[ecosystems[i]].totalSize > sizes[ecosystems[j]].totalSize
+	})
+
+	fmt.Println("Packages by ecosystem:")
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tecosystem\tpackages\tcopies\ttotal\tduplicated")
+	for _, ecosystem := range ecosystems {
+		size := sizes[ecosystem]
+		fmt.Fprintf(writer, "\t%s\t%d\t%d\t%s\t%s\n", ecosystem, size.packages, size.copies,
+			ConvertSizeBytesToHumanReadableString(size.totalSize),
+			ConvertSizeBytesToHumanReadableString(size.duplicatedSize))
+	}
+	writer.Flush()
+}
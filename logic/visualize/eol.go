@@ -0,0 +1,54 @@
+package visualize
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"ova-size-optimizer/logic/analyze"
+	"ova-size-optimizer/logic/eol"
+)
+
+// GenerateEolReport lists the images whose base OS has reached its end of
+// life, the ones past it the longest first.
+func GenerateEolReport(archivesStats map[string]*analyze.Stats, dataset *eol.Dataset, now time.Time) {
+	type eolImage struct {
+		name   string
+		baseOS string
+		status eol.Status
+	}
+	var eolImages []eolImage
+	for archivePath, archiveStats := range archivesStats {
+		status := dataset.Lookup(archiveStats.DistroID, archiveStats.DistroVersionID)
+		if !status.IsEOL(now) {
+			continue
+		}
+		for baseOS := range archiveStats.BaseOS {
+			eolImages = append(eolImages, eolImage{name: filepath.Base(archivePath), baseOS: baseOS, status: status})
+		}
+	}
+
+	if len(eolImages) == 0 {
+		fmt.Println("Images on end-of-life base OSes: none")
+		return
+	}
+
+	sort.Slice(eolImages, func(i, j int) bool {
+		if !eolImages[i].status.EOL.Equal(eolImages[j].status.EOL) {
+			return eolImages[i].status.EOL.Before(eolImages[j].status.EOL)
+		}
+		return eolImages[i].name < eolImages[j].name
+	})
+
+	fmt.Printf("Images on end-of-life base OSes: %d\n", len(eolImages))
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\timage\tbase OS\trelease\tend of life")
+	for _, image := range eolImages {
+		fmt.Fprintf(writer, "\t%s\t%s\t%s %s\t%s\n", image.name, image.baseOS, image.status.Product, image.status.Cycle,
+			image.status.EOL.Format(time.DateOnly))
+	}
+	writer.Flush()
+}
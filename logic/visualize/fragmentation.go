@@ -0,0 +1,55 @@
+package visualize
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"ova-size-optimizer/logic/analyze"
+)
+
+// GenerateFragmentationReport shows the distro releases the images are built
+// on and the consolidations that would let more of them share a base.
+func GenerateFragmentationReport(releases []*analyze.DistroRelease, consolidations []analyze.Consolidation) {
+	if len(releases) == 0 {
+		fmt.Println("Base OS releases: none")
+		return
+	}
+
+	fmt.Printf("Base OS releases: %d\n", len(releases))
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tfamily\trelease\tnames\tdistinct bases\tbases size\timages")
+	for _, release := range releases {
+		fmt.Fprintf(writer, "\t%s\t%s\t%s\t%d\t%s\t%d\n", release.Family, release.Release, strings.Join(release.Names, ", "),
+			len(release.Bases), ConvertSizeBytesToHumanReadableString(release.Size), len(release.Images))
+	}
+	writer.Flush()
+
+	if len(consolidations) == 0 {
+		fmt.Println("Base OS consolidation: nothing to consolidate")
+		return
+	}
+
+	var totalSavings int64
+	for _, consolidation := range consolidations {
+		totalSavings += consolidation.Savings
+	}
+	fmt.Printf("Base OS consolidation: would save about %s of the OVA\n", ConvertSizeBytesToHumanReadableString(totalSavings))
+	for i, consolidation := range consolidations {
+		var imageNames []string
+		for _, image := range consolidation.Images {
+			imageNames = append(imageNames, filepath.Base(image))
+		}
+
+		from := consolidation.From.Family + " " + consolidation.From.Release
+		to := consolidation.To.Family + " " + consolidation.To.Release
+		if from == to {
+			from = "other " + from + " bases"
+		}
+		fmt.Printf("\t%d. moving %d images from %s to %s lets them share a %s base (%s), saving %s: %s\n", i+1,
+			len(consolidation.Images), from, to, ConvertSizeBytesToHumanReadableString(consolidation.SharedBase.Size),
+			consolidation.SharedBase.Name, ConvertSizeBytesToHumanReadableString(consolidation.Savings), strings.Join(imageNames, ", "))
+	}
+}
@@ -0,0 +1,84 @@
+package visualize
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"ova-size-optimizer/logic/analyze"
+)
+
+// instructionsRanked is how many of the heaviest instructions of the bundle
+// are listed, and instructionMaxLength how much of each is shown.
+const (
+	instructionsRanked   = 20
+	instructionMaxLength = 100
+)
+
+// GenerateLayerInstructionReport lists the layers of an image with the
+// Dockerfile instruction that created them and their largest paths.
+func GenerateLayerInstructionReport(archiveName string, instructions []analyze.LayerInstruction) {
+	if len(instructions) == 0 {
+		return
+	}
+
+	fmt.Printf("Layers of %s:\n", archiveName)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tlayer\tsize\tcompressed\tinstruction\ttop paths")
+	for _, instruction := range instructions {
+		fmt.Fprintf(writer, "\t%d\t%s\t%s\t%s\t%s\n", instruction.Index+1,
+			ConvertSizeBytesToHumanReadableString(instruction.Size),
+			ConvertSizeBytesToHumanReadableString(instruction.CompressedSize),
+			shortenInstruction(instruction.Instruction), formatPathSizes(instruction.TopPaths))
+	}
+	writer.Flush()
+}
+
+// GenerateInstructionRankingReport lists the RUN, COPY and ADD instructions
+// of the bundle that cost the OVA the most.
+func GenerateInstructionRankingReport(ranked []analyze.LayerInstruction) {
+	if len(ranked) == 0 {
+		fmt.Println("Heaviest Dockerfile instructions: no image history")
+		return
+	}
+
+	fmt.Println("Heaviest Dockerfile instructions:")
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tcompressed\tsize\tinstruction\ttop paths\timages")
+	for i, instruction := range ranked {
+		if i == instructionsRanked {
+			break
+		}
+
+		var imageNames []string
+		for _, image := range instruction.Images {
+			imageNames = append(imageNames, filepath.Base(image))
+		}
+		fmt.Fprintf(writer, "\t%s\t%s\t%s\t%s\t%s\n",
+			ConvertSizeBytesToHumanReadableString(instruction.CompressedSize),
+			ConvertSizeBytesToHumanReadableString(instruction.Size),
+			shortenInstruction(instruction.Instruction), formatPathSizes(instruction.TopPaths), strings.Join(imageNames, ", "))
+	}
+	writer.Flush()
+}
+
+func shortenInstruction(instruction string) string {
+	instruction = strings.Join(strings.Fields(instruction), " ")
+	if instruction == "" {
+		return "(no history)"
+	}
+	if runes := []rune(instruction); len(runes) > instructionMaxLength {
+		return string(runes[:instructionMaxLength-3]) + "..."
+	}
+	return instruction
+}
+
+func formatPathSizes(paths []analyze.PathSize) string {
+	var formatted []string
+	for _, pathSize := range paths {
+		formatted = append(formatted, fmt.Sprintf("/%s %s", pathSize.Path, ConvertSizeBytesToHumanReadableString(pathSize.Size)))
+	}
+	return strings.Join(formatted, ", ")
+}
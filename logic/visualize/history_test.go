@@ -0,0 +1,32 @@
+package visualize
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestShortenInstruction(t *testing.T) {
+	tests := []struct {
+		name        string
+		instruction string
+		want        string
+	}{
+		{name: "empty", instruction: "  ", want: "(no history)"},
+		{name: "whitespace", instruction: "RUN apk add \\\n\t curl", want: "RUN apk add \\ curl"},
+		{name: "short", instruction: "COPY app /app", want: "COPY app /app"},
+		{name: "long", instruction: "RUN " + strings.Repeat("a", 200), want: "RUN " + strings.Repeat("a", instructionMaxLength-7) + "..."},
+		{name: "multi-byte", instruction: "RUN echo " + strings.Repeat("é", 200), want: "RUN echo " + strings.Repeat("é", instructionMaxLength-12) + "..."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := shortenInstruction(test.instruction)
+			if got != test.want {
+				t.Errorf("shortenInstruction() = %q, want %q", got, test.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("shortenInstruction() = %q, not valid UTF-8", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package visualize
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"ova-size-optimizer/logic/analyze"
+)
+
+// GenerateBundleLargeFileReport lists the largest files of the distinct
+// layers of the bundle.
+func GenerateBundleLargeFileReport(largeFiles []analyze.LargeFile) {
+	if len(largeFiles) == 0 {
+		fmt.Println("Largest files of the bundle: none matching")
+		return
+	}
+
+	fmt.Println("Largest files of the bundle:")
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tsize\tpath\ttype\tpackage\tlayer\timages")
+	for _, largeFile := range largeFiles {
+		var imageNames []string
+		for _, image := range largeFile.Images {
+			imageNames = append(imageNames, filepath.Base(image))
+		}
+		layer := largeFile.DiffID
+		if largeFile.Layer >= 0 {
+			layer = fmt.Sprintf("%d (%s)", largeFile.Layer+1, largeFile.DiffID)
+		}
+		fmt.Fprintf(writer, "\t%s\t/%s\t%s\t%s\t%s\t%s\n", ConvertSizeBytesToHumanReadableString(largeFile.Size), largeFile.Path,
+			largeFile.Type, packageOrNone(largeFile.Package), layer, strings.Join(imageNames, ", "))
+	}
+	writer.Flush()
+}
+
+// GenerateLargeFileReport lists the largest files of the layers of an image.
+func GenerateLargeFileReport(archiveName string, largeFiles []analyze.LargeFile) {
+	if len(largeFiles) == 0 {
+		return
+	}
+
+	fmt.Printf("Largest files of %s:\n", archiveName)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tsize\tpath\ttype\tpackage\tlayer")
+	for _, largeFile := range largeFiles {
+		fmt.Fprintf(writer, "\t%s\t/%s\t%s\t%s\t%d\n", ConvertSizeBytesToHumanReadableString(largeFile.Size), largeFile.Path,
+			largeFile.Type, packageOrNone(largeFile.Package), largeFile.Layer+1)
+	}
+	writer.Flush()
+}
+
+func packageOrNone(name string) string {
+	if name == "" {
+		return "-"
+	}
+	return name
+}
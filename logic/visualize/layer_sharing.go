@@ -0,0 +1,122 @@
+package visualize
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"ova-size-optimizer/logic/analyze"
+)
+
+// GenerateLayerSharingReport shows what every image costs the bundle once
+// the layers it shares with other images are stored only once.
+func GenerateLayerSharingReport(sharing analyze.LayerSharing) {
+	if len(sharing.Layers) == 0 {
+		fmt.Println("Layer sharing: no image layers")
+		return
+	}
+
+	fmt.Printf("Layer sharing: %d distinct layers, %s stored for %s of images, deduplication ratio %.2f\n", len(sharing.Layers),
+		ConvertSizeBytesToHumanReadableString(sharing.StoredSize), ConvertSizeBytesToHumanReadableString(sharing.TotalSize),
+		sharing.DeduplicationRatio())
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\timage\ttotal\tshared\texclusive")
+	for _, image := range sharing.Images {
+		fmt.Fprintf(writer, "\t%s\t%s\t%s\t%s\n", filepath.Base(image.Image),
+			ConvertSizeBytesToHumanReadableString(image.TotalSize),
+			ConvertSizeBytesToHumanReadableString(image.SharedSize),
+			ConvertSizeBytesToHumanReadableString(image.ExclusiveSize))
+	}
+	writer.Flush()
+
+	writer = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tlayer\tcompressed\tuncompressed\timages\timage names")
+	for _, layer := range sharing.Layers {
+		var imageNames []string
+		for _, image := range layer.Images {
+			imageNames = append(imageNames, filepath.Base(image))
+		}
+		fmt.Fprintf(writer, "\t%s\t%s\t%s\t%d\t%s\n", layer.Digest,
+			ConvertSizeBytesToHumanReadableString(layer.CompressedSize),
+			ConvertSizeBytesToHumanReadableString(layer.UncompressedSize), len(layer.Images), strings.Join(imageNames, ", "))
+	}
+	writer.Flush()
+}
+
+// GenerateRecompressedLayerReport lists the layers stored once per
+// compressed blob although their content is identical. Bundles storing
+// their layers uncompressed can't have any.
+func GenerateRecompressedLayerReport(recompressedLayers []analyze.RecompressedLayer, compressedBlobs bool) {
+	if !compressedBlobs {
+		fmt.Println("Identical layers stored under different compressed blobs: not applicable, the layers are stored uncompressed")
+		return
+	}
+	if len(recompressedLayers) == 0 {
+		fmt.Println("Identical layers stored under different compressed blobs: none")
+		return
+	}
+
+	var totalWasted int64
+	for _, recompressedLayer := range recompressedLayers {
+		totalWasted += recompressedLayer.WastedSize
+	}
+	fmt.Printf("Identical layers stored under different compressed blobs: %d, %s wasted\n", len(recompressedLayers),
+		ConvertSizeBytesToHumanReadableString(totalWasted))
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tdiffID\tblob\tcompressed\timages\timage names")
+	for _, recompressedLayer := range recompressedLayers {
+		for i, blob := range recompressedLayer.Blobs {
+			diffID := ""
+			if i == 0 {
+				diffID = fmt.Sprintf("%s (wastes %s)", recompressedLayer.DiffID, ConvertSizeBytesToHumanReadableString(recompressedLayer.WastedSize))
+			}
+
+			var imageNames []string
+			for _, image := range blob.Images {
+				imageNames = append(imageNames, filepath.Base(image))
+			}
+			fmt.Fprintf(writer, "\t%s\t%s\t%s\t%d\t%s\n", diffID, blob.Digest, ConvertSizeBytesToHumanReadableString(blob.CompressedSize),
+				len(blob.Images), strings.Join(imageNames, ", "))
+		}
+	}
+	writer.Flush()
+}
+
+// GenerateNonReproducibleLayerReport lists the layers with the same files
+// that only differ in tar metadata, which reproducible builds would dedupe.
+func GenerateNonReproducibleLayerReport(nonReproducibleLayers []analyze.NonReproducibleLayer) {
+	if len(nonReproducibleLayers) == 0 {
+		fmt.Println("Layers with identical files but different metadata: none")
+		return
+	}
+
+	var totalDedupable int64
+	for _, nonReproducibleLayer := range nonReproducibleLayers {
+		totalDedupable += nonReproducibleLayer.DedupableSize
+	}
+	fmt.Printf("Layers with identical files but different metadata: %d, reproducible builds (e.g. SOURCE_DATE_EPOCH) would dedupe %s\n",
+		len(nonReproducibleLayers), ConvertSizeBytesToHumanReadableString(totalDedupable))
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tlayer\tdiffering fields\tcompressed\timages\timage names")
+	for _, nonReproducibleLayer := range nonReproducibleLayers {
+		for i, layer := range nonReproducibleLayer.Layers {
+			fields := strings.Join(nonReproducibleLayer.DifferingFields[layer.DiffID], ", ")
+			if i == 0 {
+				fields = fmt.Sprintf("kept, dedupes %s", ConvertSizeBytesToHumanReadableString(nonReproducibleLayer.DedupableSize))
+			}
+
+			var imageNames []string
+			for _, image := range layer.Images {
+				imageNames = append(imageNames, filepath.Base(image))
+			}
+			fmt.Fprintf(writer, "\t%s\t%s\t%s\t%d\t%s\n", layer.DiffID, fields, ConvertSizeBytesToHumanReadableString(layer.CompressedSize),
+				len(layer.Images), strings.Join(imageNames, ", "))
+		}
+	}
+	writer.Flush()
+}
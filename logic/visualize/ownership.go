@@ -0,0 +1,69 @@
+package visualize
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"ova-size-optimizer/logic/analyze"
+)
+
+// unownedDirsPerLevel is how many of the largest directories are shown at
+// every level of the unowned bytes breakdown.
+const unownedDirsPerLevel = 5
+
+// GenerateFileOwnershipReport explains the bytes of an image by who owns its
+// files, and breaks the unowned ones down by directory.
+func GenerateFileOwnershipReport(archiveName string, ownership analyze.FileOwnership) {
+	total := ownership.OSPackageBytes + ownership.LanguagePackageBytes + ownership.UnownedBytes
+	fmt.Printf("Files of %s: %s in total, %s owned by OS packages, %s owned by language packages, %s unowned\n", archiveName,
+		ConvertSizeBytesToHumanReadableString(total),
+		ConvertSizeBytesToHumanReadableString(ownership.OSPackageBytes),
+		ConvertSizeBytesToHumanReadableString(ownership.LanguagePackageBytes),
+		ConvertSizeBytesToHumanReadableString(ownership.UnownedBytes))
+
+	printUnownedDirs(ownership.UnownedByDir, "/", ownership.UnownedBytes, 1)
+}
+
+func printUnownedDirs(unownedByDir map[string]int64, parent string, parentSize int64, depth int) {
+	var dirs []string
+	for dir := range unownedByDir {
+		if path.Dir(dir) == parent {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		return
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if unownedByDir[dirs[i]] != unownedByDir[dirs[j]] {
+			return unownedByDir[dirs[i]] > unownedByDir[dirs[j]]
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	// whatever isn't below a subdirectory is in the parent itself
+	remaining := parentSize
+	for _, dir := range dirs {
+		remaining -= unownedByDir[dir]
+	}
+
+	indent := strings.Repeat("\t", depth)
+	for i, dir := range dirs {
+		if i == unownedDirsPerLevel {
+			var othersSize int64
+			for _, other := range dirs[i:] {
+				othersSize += unownedByDir[other]
+			}
+			fmt.Printf("%s%d other directories: %s\n", indent, len(dirs)-i, ConvertSizeBytesToHumanReadableString(othersSize))
+			break
+		}
+
+		fmt.Printf("%s%s: %s\n", indent, dir, ConvertSizeBytesToHumanReadableString(unownedByDir[dir]))
+		printUnownedDirs(unownedByDir, dir, unownedByDir[dir], depth+1)
+	}
+	if remaining > 0 {
+		fmt.Printf("%sfiles directly in %s: %s\n", indent, parent, ConvertSizeBytesToHumanReadableString(remaining))
+	}
+}
@@ -0,0 +1,77 @@
+package visualize
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"ova-size-optimizer/logic/analyze"
+)
+
+// packagesShownPerLayer is how many of the packages a layer installs are
+// named, in alphabetical order.
+const packagesShownPerLayer = 10
+
+// GeneratePackageLayerReport tells which packages of an image come from its
+// base image and which layers on top of it installed the others, with the
+// packages later layers upgraded, modified or removed.
+func GeneratePackageLayerReport(archiveName string, stats *analyze.Stats) {
+	if len(stats.Layers) == 0 || len(stats.PackageOrigins) == 0 {
+		return
+	}
+
+	fromBase, unknown := 0, 0
+	packagesByLayer := map[int][]string{}
+	var changes []analyze.PackageChange
+	for identity, origin := range stats.PackageOrigins {
+		switch {
+		case origin.Layer == -1:
+			unknown++
+		case origin.FromBase:
+			fromBase++
+		default:
+			version, _ := analyze.PackageVersion(identity)
+			packagesByLayer[origin.Layer] = append(packagesByLayer[origin.Layer], analyze.PackageName(identity)+"@"+version)
+		}
+		changes = append(changes, origin.Changes...)
+	}
+	changes = append(changes, stats.RemovedPackages...)
+
+	added := len(stats.PackageOrigins) - fromBase - unknown
+	fmt.Printf("Packages of %s: %d from the base image, %d added on top of it, %d from an unknown layer\n", archiveName, fromBase, added, unknown)
+
+	var layers []int
+	for layer := range packagesByLayer {
+		layers = append(layers, layer)
+	}
+	sort.Ints(layers)
+	for _, layer := range layers {
+		names := packagesByLayer[layer]
+		sort.Strings(names)
+		shown := names[:min(len(names), packagesShownPerLayer)]
+		if len(names) > len(shown) {
+			shown = append(shown, fmt.Sprintf("and %d more", len(names)-len(shown)))
+		}
+		fmt.Printf("\tlayer %d (%s) added %d: %s\n", layer+1, shortenInstruction(stats.Layers[layer].CreatedBy), len(names), strings.Join(shown, ", "))
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Layer != changes[j].Layer {
+			return changes[i].Layer < changes[j].Layer
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	for _, change := range changes {
+		description := change.Kind
+		switch {
+		case change.FromVersion != "" && change.ToVersion != "":
+			description = fmt.Sprintf("%s from %s to %s", change.Kind, change.FromVersion, change.ToVersion)
+		case change.FromVersion != "":
+			description = fmt.Sprintf("%s %s", change.Kind, change.FromVersion)
+		}
+		fmt.Printf("\tnote: %s %s in layer %d (%s)\n", change.Name, description, change.Layer+1, shortenInstruction(change.Instruction))
+	}
+	for _, database := range stats.UntrackedPackageDatabases {
+		fmt.Printf("\tnote: upgrades and removals of %s packages are not reported, their database is not supported\n", database)
+	}
+}
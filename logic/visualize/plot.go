@@ -6,24 +6,69 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
 	"gonum.org/v1/plot/vg"
 
 	"ova-size-optimizer/logic/analyze"
+	"ova-size-optimizer/logic/eol"
 )
 
-func GenerateReport(archivesStats map[string]*analyze.Stats) error {
+func GenerateReport(archivesStats map[string]*analyze.Stats, eolDataset *eol.Dataset, largeFileOptions analyze.LargeFileOptions) error {
 	fmt.Println("Started generating report...")
+	now := time.Now()
+
+	rollup := analyze.RollUp(archivesStats)
+	GenerateDuplicationReport(rollup)
+	bases := analyze.BuildBaseImageTree(archivesStats)
+	GenerateBaseImageReport(bases)
+	layerSharing := analyze.AnalyzeLayerSharing(archivesStats)
+	GenerateLayerSharingReport(layerSharing)
+	GenerateRecompressedLayerReport(analyze.DetectRecompressedLayers(layerSharing), layerSharing.CompressedBlobs)
+	GenerateNonReproducibleLayerReport(analyze.DetectNonReproducibleLayers(layerSharing))
+	GenerateNearDuplicateReport(analyze.DetectNearDuplicateLayers(layerSharing))
+	GenerateDuplicatedFileReport(analyze.DetectDuplicatedFiles(layerSharing))
+	GenerateBundleLargeFileReport(analyze.FindBundleLargeFiles(archivesStats, layerSharing, largeFileOptions))
+	GenerateLayerWasteReport(analyze.DetectLayerWaste(archivesStats))
+	GenerateInstructionRankingReport(analyze.RankInstructions(archivesStats))
+	GenerateFragmentationReport(analyze.DetectBaseOSFragmentation(archivesStats, bases))
+	GenerateDriftReport(analyze.DetectVersionDrift(rollup))
+	GenerateSizeDiscrepancyReport(rollup.Packages)
+	GenerateEolReport(archivesStats, eolDataset, now)
+
+	if err := PlotStats(analyze.GetOnlyDuplicates(rollup.BaseOS), "Duplicated BaseOS Statistics", "all-images-stats-base-os.png", 10); err != nil {
+		return fmt.Errorf("error generating bar chart for duplicated BaseOS: %w", err)
+	}
+
+	if err := PlotStats(analyze.GetOnlyDuplicates(rollup.Packages), "Duplicated Package Statistics", "all-images-stats-packages.png", 10); err != nil {
+		return fmt.Errorf("error generating bar chart for duplicated packages: %w", err)
+	}
 
-	for archiveName, archiveStats := range archivesStats {
-		// duplicateBaseOS := analyze.GetOnlyDuplicates(archiveStats.BaseOS)
-		// duplicatePackages := analyze.GetOnlyDuplicates(archiveStats.Packages)
-		// duplicateRuntimes := analyze.GetOnlyDuplicatesRuntimes(archiveStats.Runtimes)
+	if err := PlotStats(analyze.GetOnlyDuplicates(rollup.Runtimes), "Duplicated Runtime Statistics", "all-images-stats-runtimes.png", 10); err != nil {
+		return fmt.Errorf("error generating bar chart for duplicated runtimes: %w", err)
+	}
 
-		archiveBaseName := filepath.Base(archiveName)
+	for archivePath, archiveStats := range archivesStats {
+		archiveBaseName := filepath.Base(archivePath)
 		archiveName := strings.Split(archiveBaseName, ".")[0]
+		if archiveStats.Source != "" {
+			fmt.Printf("Image %s from %s\n", archiveBaseName, archiveStats.Source)
+		}
+		baseOSStatus := eolDataset.Lookup(archiveStats.DistroID, archiveStats.DistroVersionID)
+		for baseOS, info := range archiveStats.BaseOS {
+			fmt.Printf("Base OS of %s: %s (%s), %s\n", archiveBaseName, baseOS, ConvertSizeBytesToHumanReadableString(info.CopySize()),
+				baseOSStatus.Describe(now))
+		}
+		for _, runtime := range archiveStats.RuntimeInstalls {
+			fmt.Printf("Runtime of %s: %s at %s (%s), %s\n", archiveBaseName, runtime.Key(), runtime.Path,
+				ConvertSizeBytesToHumanReadableString(runtime.Size), eolDataset.Lookup(runtime.Name, runtime.Version).Describe(now))
+		}
+		GenerateFileOwnershipReport(archiveBaseName, archiveStats.Files)
+		GenerateLayerInstructionReport(archiveBaseName, analyze.AttributeLayers(archivePath, archiveStats))
+		GeneratePackageLayerReport(archiveBaseName, archiveStats)
+		GenerateLargeFileReport(archiveBaseName, analyze.FindLargeFiles(archivePath, archiveStats, largeFileOptions))
 		if err := PlotStats(archiveStats.BaseOS, "BaseOS Statistics", fmt.Sprintf("%s-stats-base-os.png", archiveName), 10); err != nil {
 			return fmt.Errorf("error generating bar chart for BaseOS: %w", err)
 		}
@@ -32,7 +77,7 @@ func GenerateReport(archivesStats map[string]*analyze.Stats) error {
 			return fmt.Errorf("error generating bar chart for packages: %w", err)
 		}
 
-		if err := PlotStats(archiveStats.Runtimes[archiveName], "Runtime Statistics", fmt.Sprintf("%s-stats-runtimes.png", archiveName), 10); err != nil {
+		if err := PlotStats(archiveStats.Runtimes[archivePath], "Runtime Statistics", fmt.Sprintf("%s-stats-runtimes.png", archiveName), 10); err != nil {
 			return fmt.Errorf("error generating bar chart for runtimes: %w", err)
 		}
 	}
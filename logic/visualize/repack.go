@@ -0,0 +1,36 @@
+package visualize
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"ova-size-optimizer/logic/ova"
+)
+
+func GenerateRepackReport(result *ova.RepackResult) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\tfile\told size\tnew size\t")
+	for _, file := range result.Files {
+		replaced := ""
+		if file.Replaced {
+			replaced = "replaced"
+		}
+		fmt.Fprintf(writer, "\t%s\t%s\t%s\t%s\n", file.Name,
+			ConvertSizeBytesToHumanReadableString(file.OldSize),
+			ConvertSizeBytesToHumanReadableString(file.NewSize), replaced)
+	}
+	writer.Flush()
+
+	if result.Signed {
+		fmt.Println("Manifest signed with the provided key.")
+	}
+	if result.DroppedCertificate {
+		fmt.Println("Warn: the original certificate was dropped as it no longer matches the manifest, provide a key to re-sign.")
+	}
+
+	fmt.Printf("OVA size: %s -> %s (%s saved)\n",
+		ConvertSizeBytesToHumanReadableString(result.OldSize),
+		ConvertSizeBytesToHumanReadableString(result.NewSize),
+		ConvertSizeBytesToHumanReadableString(result.OldSize-result.NewSize))
+}
@@ -0,0 +1,61 @@
+package visualize
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ova-size-optimizer/logic/analyze"
+)
+
+// differingFilesShown is how many of the differing files of a layer are
+// listed, the largest first.
+const differingFilesShown = 5
+
+// GenerateNearDuplicateReport lists the clusters of layers mostly made of the
+// same files, with the files that make them differ.
+func GenerateNearDuplicateReport(clusters []analyze.NearDuplicateCluster) {
+	if len(clusters) == 0 {
+		fmt.Println("Near-duplicate layers: none")
+		return
+	}
+
+	var totalSavings int64
+	for _, cluster := range clusters {
+		totalSavings += cluster.Savings
+	}
+	fmt.Printf("Near-duplicate layers: %d clusters, moving their common files to shared layers would save %s\n", len(clusters),
+		ConvertSizeBytesToHumanReadableString(totalSavings))
+
+	for i, cluster := range clusters {
+		fmt.Printf("\t%d. %d layers with %s of identical files, saves %s\n", i+1, len(cluster.Layers),
+			ConvertSizeBytesToHumanReadableString(cluster.CommonSize), ConvertSizeBytesToHumanReadableString(cluster.Savings))
+		for _, layer := range cluster.Layers {
+			var imageNames []string
+			for _, image := range layer.Images {
+				imageNames = append(imageNames, filepath.Base(image))
+			}
+			fmt.Printf("\t\t%s (%s): %s\n", layer.DiffID, ConvertSizeBytesToHumanReadableString(layer.UncompressedSize), strings.Join(imageNames, ", "))
+
+			differingFiles := append([]analyze.LayerFile(nil), cluster.DifferingFiles[layer.DiffID]...)
+			sortLayerFilesBySize(differingFiles)
+			for j, file := range differingFiles {
+				if j == differingFilesShown {
+					fmt.Printf("\t\t\t%d other differing files\n", len(differingFiles)-j)
+					break
+				}
+				fmt.Printf("\t\t\t/%s: %s\n", strings.TrimPrefix(file.Path, "/"), ConvertSizeBytesToHumanReadableString(file.Size))
+			}
+		}
+	}
+}
+
+func sortLayerFilesBySize(files []analyze.LayerFile) {
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Size != files[j].Size {
+			return files[i].Size > files[j].Size
+		}
+		return files[i].Path < files[j].Path
+	})
+}
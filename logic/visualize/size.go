@@ -0,0 +1,19 @@
+package visualize
+
+import "fmt"
+
+func ConvertSizeBytesToHumanReadableString(sizeBytes int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+
+	if sizeBytes == 0 {
+		return "0B"
+	}
+	size := float64(sizeBytes)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024 // Divide size by 1024 to convert to the next higher unit
+		i++
+	}
+
+	return fmt.Sprintf("%.2f%s", size, units[i])
+}
@@ -0,0 +1,58 @@
+package visualize
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"ova-size-optimizer/logic/analyze"
+)
+
+// wastedFilesShown is how many of the wasted files of an image are listed,
+// the largest first.
+const wastedFilesShown = 10
+
+// GenerateLayerWasteReport scores every image by the share of its layer bytes
+// still visible in it, and lists the files later layers delete or overwrite.
+func GenerateLayerWasteReport(wastes []analyze.ImageWaste) {
+	if len(wastes) == 0 {
+		fmt.Println("Files deleted or overwritten by later layers: no image layers")
+		return
+	}
+
+	var totalWasted int64
+	for _, waste := range wastes {
+		totalWasted += waste.WastedSize
+	}
+	fmt.Printf("Files deleted or overwritten by later layers: %s wasted\n", ConvertSizeBytesToHumanReadableString(totalWasted))
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "\timage\tefficiency\twasted\tlayers total")
+	for _, waste := range wastes {
+		fmt.Fprintf(writer, "\t%s\t%.1f%%\t%s\t%s\n", filepath.Base(waste.Image), waste.Efficiency()*100,
+			ConvertSizeBytesToHumanReadableString(waste.WastedSize), ConvertSizeBytesToHumanReadableString(waste.TotalSize))
+	}
+	writer.Flush()
+
+	for _, waste := range wastes {
+		if len(waste.Files) == 0 {
+			continue
+		}
+
+		fmt.Printf("Wasted files of %s:\n", filepath.Base(waste.Image))
+		for i, file := range waste.Files {
+			if i == wastedFilesShown {
+				fmt.Printf("\t%d other wasted files\n", len(waste.Files)-i)
+				break
+			}
+
+			removal := "deleted"
+			if file.Overwritten {
+				removal = "overwritten"
+			}
+			fmt.Printf("\t/%s: %s, added in layer %d (%s), %s in layer %d (%s)\n", file.Path, ConvertSizeBytesToHumanReadableString(file.Size),
+				file.AddedIn+1, file.AddedBy, removal, file.RemovedIn+1, file.RemovedBy)
+		}
+	}
+}
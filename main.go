@@ -1,36 +1,194 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"ova-size-optimizer/logic/analyze"
+	"ova-size-optimizer/logic/disk"
+	"ova-size-optimizer/logic/eol"
 	"ova-size-optimizer/logic/ociimage"
+	"ova-size-optimizer/logic/ova"
 	"ova-size-optimizer/logic/visualize"
 )
 
 func main() {
-	ovaImagePath := os.Args[1]
-	if ovaImagePath == "" {
+	if len(os.Args) < 2 || os.Args[1] == "" {
 		fmt.Println("Please provide ova path as an argument")
 		os.Exit(1)
 	}
 
-	if err := ociimage.TransformAndCopyOciToDockerImage(ovaImagePath); err != nil {
-		fmt.Printf("error processing OCI image: %v\n", err)
+	switch os.Args[1] {
+	case "disk":
+		if len(os.Args) < 3 {
+			fmt.Println("Please provide bundle paths as arguments: disk <ova|qcow2 dir|raw dir>...")
+			os.Exit(1)
+		}
+		analyzeDisks(os.Args[2:])
+	case "repack":
+		repackOva(os.Args[2:])
+	default:
+		analyzeBundle(os.Args[1:])
+	}
+}
+
+type globsFlag []string
+
+func (g *globsFlag) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *globsFlag) Set(value string) error {
+	if err := analyze.ValidateGlobs([]string{value}); err != nil {
+		return err
+	}
+	*g = append(*g, value)
+	return nil
+}
+
+func analyzeBundle(args []string) {
+	var includes, excludes globsFlag
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	topFiles := flags.Int("top-files", 10, "number of largest files listed per image and for the bundle")
+	flags.Var(&includes, "include", "only list the large files matching a glob, on the name or on the path when it has a / (repeatable)")
+	flags.Var(&excludes, "exclude", "don't list the large files matching a glob, on the name or on the path when it has a / (repeatable)")
+	minFileSize := flags.Int64("min-file-size", 0, "minimum size in bytes of the large files listed")
+	flags.Parse(args)
+
+	// the appliance OVA is optional, when given its guest OS is analyzed too
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		fmt.Println("Please provide the bundle path and optionally the appliance ova: [-top-files n] [-include glob] [-exclude glob] [-min-file-size bytes] <bundle> [ova]")
+		os.Exit(1)
+	}
+	if *topFiles < 0 || *minFileSize < 0 {
+		fmt.Println("Please provide a -top-files and -min-file-size of 0 or more")
+		flags.Usage()
 		os.Exit(1)
 	}
+	guestOvaPath := ""
+	if flags.NArg() == 2 {
+		guestOvaPath = flags.Arg(1)
+	}
+	analyzeContainers(flags.Arg(0), guestOvaPath, analyze.LargeFileOptions{
+		Top:     *topFiles,
+		Include: includes,
+		Exclude: excludes,
+		MinSize: *minFileSize,
+	})
+}
+
+func analyzeContainers(ovaImagePath, guestOvaPath string, largeFileOptions analyze.LargeFileOptions) {
+	if err := ociimage.TransformAndCopyImageBundle(ovaImagePath); err != nil {
+		fmt.Printf("error processing image bundle: %v\n", err)
+		os.Exit(1)
+	}
+
+	guestRootFsHardlinks := map[string]map[string]string{}
+	if guestOvaPath != "" {
+		guestRootFilesystems, err := disk.ExtractGuestRootFs(guestOvaPath)
+		if err != nil {
+			fmt.Printf("error extracting guest root filesystem: %v\n", err)
+			os.Exit(1)
+		}
+		for _, guestRootFs := range guestRootFilesystems {
+			guestRootFsHardlinks[guestRootFs.Dir] = guestRootFs.Hardlinks
+		}
+		visualize.GenerateGuestRootFsReport(guestRootFilesystems)
+	}
 
-	archivesStats, err := analyze.Analyze(ociimage.IndividualArchivesDir)
+	archivesStats, err := analyze.Analyze(ociimage.IndividualArchivesDir, guestRootFsHardlinks)
 	if err != nil {
 		fmt.Printf("error anaylzing individual archives: %v\n", err)
 		os.Exit(1)
 	}
+	for archiveName, archiveStats := range archivesStats {
+		archiveStats.Source = ociimage.ImageSources[archiveName]
+		if archiveStats.Source == "" && guestOvaPath != "" {
+			archiveStats.Source = guestOvaPath
+		}
+		// the individual archives only know the layers uncompressed
+		for i, layerBlob := range ociimage.ImageLayerBlobs[archiveName] {
+			if i < len(archiveStats.Layers) && layerBlob.Size >= 0 {
+				archiveStats.Layers[i].BlobDigest = layerBlob.Digest
+				archiveStats.Layers[i].CompressedSize = layerBlob.Size
+			}
+		}
+	}
+
+	eolDataset, err := eol.Load()
+	if err != nil {
+		fmt.Printf("error loading end-of-life dataset: %v\n", err)
+		os.Exit(1)
+	}
 
 	// TODO: change this to a HTML report
-	err = visualize.GenerateReport(archivesStats)
+	err = visualize.GenerateReport(archivesStats, eolDataset, largeFileOptions)
 	if err != nil {
 		fmt.Printf("error generating report: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+func analyzeDisks(bundlePaths []string) {
+	var freeSpaceReports []*disk.FreeSpaceReport
+	for _, bundlePath := range bundlePaths {
+		bundleReports, err := disk.AnalyzeFreeSpace(bundlePath)
+		if err != nil {
+			fmt.Printf("error analyzing disks of %s: %v\n", bundlePath, err)
+			os.Exit(1)
+		}
+		freeSpaceReports = append(freeSpaceReports, bundleReports...)
+	}
+
+	if err := visualize.GenerateFreeSpaceReport(freeSpaceReports); err != nil {
+		fmt.Printf("error generating free space report: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+type replacementsFlag map[string]string
+
+func (r replacementsFlag) String() string {
+	return fmt.Sprint(map[string]string(r))
+}
+
+func (r replacementsFlag) Set(value string) error {
+	name, replacement, found := strings.Cut(value, "=")
+	if !found {
+		return fmt.Errorf("expected <ova file>=<local file>, got %s", value)
+	}
+	r[name] = replacement
+	return nil
+}
+
+func repackOva(args []string) {
+	replacements := replacementsFlag{}
+	flags := flag.NewFlagSet("repack", flag.ExitOnError)
+	flags.Var(replacements, "replace", "replace an ova file with a local one, as <ova file>=<local file> (repeatable)")
+	keyPath := flags.String("key", "", "PEM private key used to re-sign the manifest")
+	certPath := flags.String("cert", "", "PEM certificate matching the signing key")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		fmt.Println("Please provide the input and output ova paths: repack [-replace name=file] [-key key.pem -cert cert.pem] <in.ova> <out.ova>")
+		os.Exit(1)
+	}
+	if (*keyPath == "") != (*certPath == "") {
+		fmt.Println("Please provide both -key and -cert to re-sign the ova")
+		os.Exit(1)
+	}
+
+	result, err := ova.Repack(flags.Arg(0), flags.Arg(1), ova.RepackOptions{
+		Replacements: replacements,
+		KeyPath:      *keyPath,
+		CertPath:     *certPath,
+	})
+	if err != nil {
+		fmt.Printf("error repacking ova: %v\n", err)
+		os.Exit(1)
+	}
+
+	visualize.GenerateRepackReport(result)
+}